@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Aliases: shortcuts of your own, from the config file, eg:
+//
+//   "Aliases": {
+//     "web": "droplets ls --filter name~^web-",
+//     "redeploy": "-w droplets destroy $1; -w droplets new $1 --size 1gb"
+//   }
+//
+// An alias is a command line, or several separated by ';', run as lines of
+// 'diocean shell'.  Its arguments replace $1 .. $9, or all of them $@, when
+// it has none of those they are added to the end of its command.  Each alias
+// is a route, so it is listed by help and completes like the built in
+// commands.  Built in commands can't be replaced.
+
+type Alias struct {
+	Name     string
+	Text     string
+	Commands []string
+	// the config file it is from
+	Path string
+}
+
+var aliasNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+var aliasArgPattern = regexp.MustCompile(`\$[1-9@]`)
+var safeWordPattern = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./~^-]+$`)
+
+// runningAliases catches an alias that ends up running itself.
+var runningAliases = make(map[string]bool)
+
+func ParseAlias(name, text string) (*Alias, error) {
+	if !aliasNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid alias name, expected a single word")
+	}
+	if IsBuiltinCommand(name) && FindAlias(name) == nil {
+		return nil, fmt.Errorf("'%s' is a built in command", name)
+	}
+
+	commands := SplitCommands(text)
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("no command")
+	}
+	for _, command := range commands {
+		if _, err := SplitCommandLine(command); err != nil {
+			return nil, fmt.Errorf("%s: %s", command, err)
+		}
+	}
+	return &Alias{Name: name, Text: text, Commands: commands}, nil
+}
+
+// SplitCommands splits text into commands at the ';'s that aren't quoted or
+// escaped.
+func SplitCommands(text string) []string {
+	commands := make([]string, 0)
+	add := func(command string) {
+		if command = strings.TrimSpace(command); command != "" {
+			commands = append(commands, command)
+		}
+	}
+
+	runes := []rune(text)
+	start := 0
+	var quote rune
+	for ii := 0; ii < len(runes); ii++ {
+		r := runes[ii]
+		switch {
+		case r == '\\' && quote != '\'':
+			ii++
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';':
+			add(string(runes[start:ii]))
+			start = ii + 1
+		}
+	}
+	add(string(runes[start:]))
+	return commands
+}
+
+// TakesArgs is true when the alias places its arguments with $1 .. $9 or $@.
+func (self *Alias) TakesArgs() bool {
+	return aliasArgPattern.MatchString(self.Text)
+}
+
+// Expand returns the alias's commands with its arguments in them, quoted so
+// each stays one word.
+func (self *Alias) Expand(args []string) ([]string, error) {
+	commands := make([]string, 0, len(self.Commands))
+	if !self.TakesArgs() {
+		commands = append(commands, self.Commands...)
+		if len(args) > 0 {
+			if len(commands) > 1 {
+				return nil, UsageError("alias '%s' runs several commands, it takes arguments only as $1 .. $9 or $@", self.Name)
+			}
+			commands[0] += " " + QuoteWords(args)
+		}
+		return commands, nil
+	}
+
+	missing := 0
+	for _, command := range self.Commands {
+		commands = append(commands, aliasArgPattern.ReplaceAllStringFunc(command, func(ref string) string {
+			if ref == "$@" {
+				return QuoteWords(args)
+			}
+			nth := int(ref[1] - '0')
+			if nth > len(args) {
+				if nth > missing {
+					missing = nth
+				}
+				return ""
+			}
+			return QuoteWord(args[nth-1])
+		}))
+	}
+	if missing > 0 {
+		return nil, UsageError("alias '%s' needs at least %d arguments, got %d", self.Name, missing, len(args))
+	}
+	return commands, nil
+}
+
+// QuoteWord quotes a word for SplitCommandLine, as it is when it needs none.
+func QuoteWord(word string) string {
+	if safeWordPattern.MatchString(word) {
+		return word
+	}
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+func QuoteWords(words []string) string {
+	quoted := make([]string, len(words))
+	for ii, word := range words {
+		quoted[ii] = QuoteWord(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Run runs the alias's commands, the first to fail stops it.  Flags given
+// before the alias apply to each of its commands.
+func (self *Alias) Run(args []string) error {
+	if runningAliases[self.Name] {
+		return UsageError("alias '%s' runs itself", self.Name)
+	}
+	runningAliases[self.Name] = true
+	defer delete(runningAliases, self.Name)
+
+	commands, err := self.Expand(args)
+	if err != nil {
+		return err
+	}
+
+	runner := NewLineRunner()
+	defer runner.Begin()()
+	for _, command := range commands {
+		Debugf("Alias %s: %s\n", self.Name, command)
+		if err := runner.RunLine(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Route is the alias as a command: its name, then any arguments.
+func (self *Alias) Route() *Route {
+	helpText := fmt.Sprintf("Alias for '%s'.", self.Text)
+	if self.TakesArgs() {
+		helpText += "\nIts arguments replace $1 .. $9, or all of them $@."
+	} else if len(self.Commands) == 1 {
+		helpText += "\nIts arguments are added to the end of the command."
+	}
+
+	route := NewRoute(self.Name, func(route *Route) error {
+		return self.Run(route.VarParams["args"])
+	}, Optional(Variadic(AliasArgsParam))).Describe(helpText, "")
+	route.Alias = self
+	route.CompletionsFn = self.Completions
+	return route
+}
+
+// Completions for an alias's arguments are those of its command, when they
+// go on the end of it.
+func (self *Alias) Completions(route *Route, param string, word string) []string {
+	if len(self.Commands) > 1 || self.TakesArgs() {
+		return []string{}
+	}
+	args, err := SplitCommandLine(self.Commands[0])
+	if err != nil {
+		return []string{}
+	}
+	args = append(args, route.Args...)
+	if word == "" && (len(route.Args) == 0 || route.Args[len(route.Args)-1] != "") {
+		args = append(args, "")
+	}
+
+	words, err := CompletionWords(args)
+	if err != nil {
+		return []string{}
+	}
+	return words
+}
+
+// Options are the route options of the alias's command, when its arguments
+// go on the end of it, eg: --size for 'droplets new'.
+func (self *Alias) Options() []*ParamSpec {
+	options := make([]*ParamSpec, 0)
+	if len(self.Commands) > 1 || self.TakesArgs() {
+		return options
+	}
+	words, err := SplitCommandLine(self.Commands[0])
+	if err != nil {
+		return options
+	}
+	for _, route := range FindPotentialRoutes(StripRouteOptions(words)) {
+		options = append(options, route.Options...)
+	}
+	return options
+}
+
+// FindAlias finds the alias routed by name, nil when there is none.
+func FindAlias(name string) *Alias {
+	for _, route := range RoutingTable {
+		if route.Alias != nil && route.Alias.Name == name {
+			return route.Alias
+		}
+	}
+	return nil
+}
+
+// AddAliasRoutes adds the aliases to the RoutingTable.
+func AddAliasRoutes(aliases map[string]*Alias) {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if FindAlias(name) == nil {
+			RoutingTable = append(RoutingTable, aliases[name].Route())
+		}
+	}
+}
+
+// LoadAliases adds the aliases of the config file to the RoutingTable.  The
+// file's problems are left for LoadConfig, or 'config validate', to report.
+func LoadAliases(path string) {
+	if file, _ := ReadConfigFile(path); file != nil {
+		AddAliasRoutes(file.Aliases)
+	}
+}
+
+// DecodeAliases reads the Aliases table of a config file.  An alias that is
+// no good is left out, and reported by 'config validate'.
+func DecodeAliases(path string, raw map[string]interface{}, aliases map[string]*Alias) []error {
+	value, ok := raw["Aliases"]
+	if !ok {
+		return nil
+	}
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		return []error{&ConfigError{path, "Aliases", "expected a table of aliases", true}}
+	}
+
+	problems := make([]error, 0)
+	for _, name := range sortedKeys(table) {
+		context := "Aliases." + name
+		text, ok := table[name].(string)
+		if !ok {
+			problems = append(problems, &ConfigError{path, context, "expected a command, or commands separated by ';'", false})
+			continue
+		}
+		alias, err := ParseAlias(name, text)
+		if err != nil {
+			problems = append(problems, &ConfigError{path, context, err.Error(), false})
+			continue
+		}
+		alias.Path = path
+		aliases[name] = alias
+	}
+	return problems
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommands(t *testing.T) {
+	cases := []struct {
+		Text     string
+		Expected []string
+	}{
+		{"droplets ls", SArray("droplets ls")},
+		{"droplets ls; regions ls ;", SArray("droplets ls", "regions ls")},
+		{`-o template='{{.Name}};' droplets ls; sizes ls`, SArray(`-o template='{{.Name}};' droplets ls`, "sizes ls")},
+		{`droplets new "a;b" c\;d`, SArray(`droplets new "a;b" c\;d`)},
+		{" ; ", SArray()},
+	}
+
+	for _, tc := range cases {
+		commands := SplitCommands(tc.Text)
+		if !StringArraysMatch(tc.Expected, commands) {
+			t.Errorf("SplitCommands(%q) => %q, expected %q", tc.Text, commands, tc.Expected)
+		}
+	}
+}
+
+func TestAliasExpand(t *testing.T) {
+	InitRoutingTable()
+	cases := []struct {
+		Text     string
+		Args     []string
+		Expected []string
+	}{
+		{"droplets ls --filter name~^web-", nil, SArray("droplets ls --filter name~^web-")},
+		{"droplets ls", SArray("-o", "json"), SArray("droplets ls -o json")},
+		{"droplets show $1", SArray("web 1"), SArray("droplets show 'web 1'")},
+		{"droplets new $1 --size $2; events wait $1", SArray("it's", "1gb"), SArray(`droplets new 'it'\''s' --size 1gb`, `events wait 'it'\''s'`)},
+		{"droplets reboot $@", SArray("1", "2"), SArray("droplets reboot 1 2")},
+	}
+
+	for _, tc := range cases {
+		alias, err := ParseAlias("test", tc.Text)
+		if err != nil {
+			t.Fatalf("ParseAlias(%q) => %s", tc.Text, err)
+		}
+		commands, err := alias.Expand(tc.Args)
+		if err != nil || !StringArraysMatch(tc.Expected, commands) {
+			t.Errorf("Expand(%q, %q) => %q, %v, expected %q", tc.Text, tc.Args, commands, err, tc.Expected)
+		}
+	}
+
+	for _, tc := range []struct {
+		Text string
+		Args []string
+	}{
+		{"droplets show $2", SArray("1")},
+		{"droplets ls; regions ls", SArray("-o", "json")},
+	} {
+		alias, _ := ParseAlias("test", tc.Text)
+		if _, err := alias.Expand(tc.Args); ExitCode(err) != ExitUsage {
+			t.Errorf("Expand(%q, %q) => %v, expected a usage error", tc.Text, tc.Args, err)
+		}
+	}
+}
+
+func TestDecodeAliases(t *testing.T) {
+	InitRoutingTable()
+	file, problems := ParseConfigFile("test.json", []byte(`{
+  "ClientId": "client-1",
+  "Aliases": {
+    "web": "droplets ls --filter name~^web-",
+    "mk": "droplets new",
+    "droplets": "droplets ls",
+    "bad name": "droplets ls",
+    "quote": "droplets new 'web1",
+    "number": 12
+  }
+}`))
+
+	if file == nil || len(file.Aliases) != 2 || file.Aliases["web"] == nil {
+		t.Fatalf("ParseConfigFile aliases => %v, %v", file, problems)
+	}
+	if len(problems) != 4 || FirstFatal(problems) != nil {
+		t.Errorf("ParseConfigFile should report the 4 bad aliases, none fatal => %v", problems)
+	}
+	for _, key := range SArray("Aliases.bad name", "Aliases.droplets", "Aliases.number", "Aliases.quote") {
+		found := false
+		for _, problem := range problems {
+			found = found || strings.Contains(problem.Error(), key+":")
+		}
+		if !found {
+			t.Errorf("ParseConfigFile should report %s => %v", key, problems)
+		}
+	}
+
+	AddAliasRoutes(file.Aliases)
+	if route := FindMatchingRoute(SArray("web", "-o", "json")); route == nil || route.Alias == nil {
+		t.Errorf("FindMatchingRoute(web -o json) => %v", route)
+	}
+	if words := FindCompletionWords(SArray("w")); !StringArraysMatch(SArray("web"), words) {
+		t.Errorf("FindCompletionWords(w) => %v", words)
+	}
+	if words, _ := RouteOptionCompletions(SArray("mk", "web1", "--si")); !StringArraysMatch(SArray("--size"), words) {
+		t.Errorf("RouteOptionCompletions(mk web1 --si) => %v", words)
+	}
+	if len(CheckRoutingTable(RoutingTable)) > 0 {
+		t.Errorf("CheckRoutingTable with aliases => %v", CheckRoutingTable(RoutingTable))
+	}
+}
+
+func TestAliasRun(t *testing.T) {
+	InitRoutingTable()
+	savedConfig, savedOptions := Config, CmdlineOptions
+	defer func() { Config, CmdlineOptions = savedConfig, savedOptions }()
+	Config = MockSettings(t, map[string]string{"ClientId": "client-1", "ApiKey": "key-1"})
+	CmdlineOptions.Output = OutputText
+
+	out, err := ioutil.TempFile("", "diocean-aliases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	aliases := make(map[string]*Alias)
+	for name, text := range map[string]string{
+		"one":  "dns 0 $1 --ttl 60",
+		"app":  "dns 0",
+		"both": "dns 0 first; dns 0 $@",
+		"stop": "dns 3; dns 0 never",
+		"loop": "one x; loop",
+	} {
+		alias, err := ParseAlias(name, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aliases[name] = alias
+	}
+	AddAliasRoutes(aliases)
+
+	// the plugin writes its arguments, then exits with the first of them
+	withPlugins(t, `echo "$*" >> `+out.Name()+`
+exit $1
+`, func(bin1, bin2 string) {
+		cases := []struct {
+			Args     []string
+			Code     int
+			Expected string
+		}{
+			{SArray("one", "it's here"), ExitOk, "0 it's here --ttl 60\n"},
+			{SArray("app", "x", "--y"), ExitOk, "0 x --y\n"},
+			{SArray("both", "a", "b"), ExitOk, "0 first\n0 a b\n"},
+			{SArray("stop"), 3, "3\n"},
+			{SArray("loop"), ExitUsage, "0 x --ttl 60\n"},
+		}
+
+		for _, tc := range cases {
+			ioutil.WriteFile(out.Name(), nil, 0644)
+			err := RunRoute(FindMatchingRoute(tc.Args), tc.Args)
+			content, _ := ioutil.ReadFile(out.Name())
+			if ExitCode(err) != tc.Code || string(content) != tc.Expected {
+				t.Errorf("%q => %v (exit code %d), ran %q, expected exit code %d, %q", tc.Args, err, ExitCode(err), content, tc.Code, tc.Expected)
+			}
+		}
+	})
+}
+
+func TestCheckAliasRoutes(t *testing.T) {
+	alias := &Alias{Name: "shell", Text: "droplets ls", Commands: SArray("droplets ls"), Path: "/tmp/aliases.json"}
+	problems := CheckRoutingTable([]*Route{NewRoute("shell", DoShell), alias.Route()})
+	if len(problems) != 1 || !strings.HasPrefix(problems[0].Error(), "/tmp/aliases.json: Aliases.shell: ") {
+		t.Errorf("CheckRoutingTable with a conflicting alias => %v", problems)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Thin access to the v1 HTTP API for structured output, where the client
+// library only prints its results.  Responses are kept as generic maps so
+// that structured output can pass along everything the API sent back.  The
+// library's own calls go through ApiTransport, so they are checked the same
+// way.
+
+var ApiBaseUrl string = "https://api.digitalocean.com/v1"
+
+// ApiHttpClient gives up on calls that take longer than a minute.
+var ApiHttpClient = &http.Client{Timeout: 60 * time.Second, Transport: apiTransport}
+
+var apiTransport = &ApiTransport{Base: http.DefaultTransport}
+
+type ApiResponse map[string]interface{}
+
+func ApiUrl(path string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("client_id", Client.ClientId)
+	params.Set("api_key", Client.ApiKey)
+	return ApiBaseUrl + path + "?" + params.Encode()
+}
+
+func ApiCall(path string, params url.Values) (ApiResponse, error) {
+	// eg: 'help' looking up the allowed values without a config
+	if Client.ClientId == "" || Client.ApiKey == "" {
+		return nil, WithExitCode(ExitConfig, fmt.Errorf("%s: no ClientId and ApiKey to call the API with, see 'diocean config init'", path))
+	}
+	apiUrl := ApiUrl(path, params)
+
+	req, err := http.NewRequestWithContext(CommandContext, "GET", apiUrl, nil)
+	if err != nil {
+		return nil, WithExitCode(ExitApi, fmt.Errorf("%s", RedactText(err.Error())))
+	}
+	// newer auth, passed along for the endpoints that accept it
+	if token := Config.Token; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpResp, err := ApiHttpClient.Do(req)
+	if CommandContext.Err() != nil {
+		return nil, CancelledError("interrupted")
+	}
+	if err != nil {
+		return nil, RequestError(err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, WithExitCode(ExitApi, err)
+	}
+	return CheckApiResponse(path, httpResp.StatusCode, body)
+}
+
+// RequestError is the error of a call that got no response, with the url
+// it names redacted, credentials and all.
+func RequestError(err error) error {
+	code := ExitApi
+	if ExitCode(err) == ExitTimeout {
+		code = ExitTimeout
+	}
+	return &ExitError{Code: code, Err: fmt.Errorf("%s", RedactText(err.Error()))}
+}
+
+// CheckApiResponse decodes the body of a response from path, the error is
+// classified by ApiError when the call failed.
+func CheckApiResponse(path string, statusCode int, body []byte) (ApiResponse, error) {
+	var resp ApiResponse
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, ApiError(statusCode, fmt.Sprintf("invalid response from %s (HTTP %d): %s", path, statusCode, err))
+	}
+
+	if status, _ := resp["status"].(string); status != "OK" {
+		return resp, ApiError(statusCode, fmt.Sprintf("%s: %v", path, resp["error_message"]))
+	}
+
+	return resp, nil
+}
+
+// ApiTransport carries the calls to the API, diocean's own and the client
+// library's, which makes them with net/http's default client, see
+// NewClient.  Each call is shown, redacted, with -v.  The library only
+// prints what it gets back, so the first of its calls to fail is kept for
+// PrintChecked.
+type ApiTransport struct {
+	Base   http.RoundTripper
+	lock   sync.Mutex
+	failed error
+}
+
+func (self *ApiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	Debugf("ApiCall: %s %s\n", req.Method, req.URL)
+	httpResp, err := self.Base.RoundTrip(req)
+	if err != nil {
+		self.fail(RequestError(err))
+		return nil, err
+	}
+
+	// the body is read here to be checked, and put back for the caller
+	body, err := ioutil.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		self.fail(WithExitCode(ExitApi, err))
+		return nil, err
+	}
+	httpResp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if _, err := CheckApiResponse(req.URL.Path, httpResp.StatusCode, body); err != nil {
+		self.fail(err)
+	}
+	return httpResp, nil
+}
+
+func (self *ApiTransport) fail(err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.failed == nil {
+		self.failed = err
+	}
+}
+
+// takeFailure returns the call that failed since the last takeFailure.
+func (self *ApiTransport) takeFailure() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	err := self.failed
+	self.failed = nil
+	return err
+}
+
+// UseApiTransport has the client library's calls go through apiTransport.
+func UseApiTransport() {
+	if http.DefaultTransport != http.RoundTripper(apiTransport) {
+		http.DefaultTransport = apiTransport
+	}
+	http.DefaultClient.Timeout = ApiHttpClient.Timeout
+}
+
+// PrintChecked runs one of the client library's printers, returning the
+// error of the first of its calls to the API that failed.
+func PrintChecked(printFn func()) error {
+	apiTransport.takeFailure()
+	printFn()
+	return apiTransport.takeFailure()
+}
+
+// ApiList fetches a list, checked as ApiCall checks any call, into one of the
+// client library's list responses, eg: &diocean.RegionResponse{}.
+func ApiList(path string, resp interface{}) PerformCall {
+	return func() (interface{}, error) {
+		apiResp, err := ApiCall(path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := json.Marshal(apiResp)
+		if err == nil {
+			err = json.Unmarshal(body, resp)
+		}
+		if err != nil {
+			return nil, WithExitCode(ExitApi, fmt.Errorf("invalid response from %s: %s", path, err))
+		}
+		return resp, nil
+	}
+}
+
+// eg: "Not Found", "No Droplets Found"
+var notFoundPattern = regexp.MustCompile(`\bnot found\b|\bno \w+ found\b`)
+
+// ApiError classifies a failed call by its HTTP status or, as the v1 API
+// often answers 200 with an error_message, by the message.
+func ApiError(statusCode int, msg string) error {
+	code := ExitApi
+	lower := strings.ToLower(msg)
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden,
+		strings.Contains(lower, "access denied"), strings.Contains(lower, "authentication"):
+		code = ExitAuth
+	case statusCode == http.StatusNotFound, notFoundPattern.MatchString(lower):
+		code = ExitNotFound
+	case statusCode == http.StatusGatewayTimeout:
+		code = ExitTimeout
+	}
+	return &ExitError{Code: code, Err: fmt.Errorf("%s", msg)}
+}
+
+// EventId returns the event_id of a response from one of the droplet or
+// image actions, if it has one.  Creating a droplet nests the event_id in
+// the new droplet.
+func (self ApiResponse) EventId() (string, bool) {
+	if id, ok := self["event_id"].(float64); ok {
+		return fmt.Sprintf("%.f", id), true
+	}
+
+	for _, val := range self {
+		if obj, ok := val.(map[string]interface{}); ok {
+			if id, ok := obj["event_id"].(float64); ok {
+				return fmt.Sprintf("%.f", id), true
+			}
+		}
+	}
+	return "", false
+}
+
+// ResourceId returns the id of the object in a response, eg: the droplet
+// of 'droplets show' or 'droplets new'.
+func (self ApiResponse) ResourceId() (string, bool) {
+	for _, val := range self {
+		if obj, ok := val.(map[string]interface{}); ok {
+			if id, ok := obj["id"].(float64); ok {
+				return fmt.Sprintf("%.f", id), true
+			}
+		}
+	}
+	return "", false
+}
+
+// EventWaitTimeout limits how long an event is waited on, 0 is no limit.
+var EventWaitTimeout time.Duration
+
+func ApiWaitForEvent(eventId string) (ApiResponse, error) {
+	started := time.Now()
+	for {
+		resp, err := ApiCall("/events/"+eventId, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		event, _ := resp["event"].(map[string]interface{})
+		if CmdlineOptions.Verbose {
+			fmt.Fprintf(os.Stderr, "ApiWaitForEvent[%s]: %v%%\n", eventId, event["percentage"])
+		}
+		if pct, _ := event["percentage"].(string); pct == "100" {
+			return resp, nil
+		}
+		if pct, _ := event["percentage"].(float64); pct >= 100 {
+			return resp, nil
+		}
+
+		if EventWaitTimeout > 0 && time.Since(started) >= EventWaitTimeout {
+			return nil, &ExitError{Code: ExitTimeout, Err: fmt.Errorf("event %s did not complete within %s", eventId, EventWaitTimeout)}
+		}
+		select {
+		case <-time.After(5 * time.Second):
+		case <-CommandContext.Done():
+			return nil, CancelledError("interrupted")
+		}
+	}
+}
+
+// SetSlugOrId sets name_id when value is numeric and name_slug otherwise,
+// the API accepts either form for sizes, images and regions.
+func SetSlugOrId(params url.Values, name, value string) {
+	if _, err := strconv.Atoi(value); err == nil {
+		params.Set(name+"_id", value)
+		return
+	}
+	params.Set(name+"_slug", value)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// 'diocean batch': runs the commands in a file, one per line, eg:
+//
+//   # deploy.txt
+//   REGION=nyc2
+//   -w droplets new web1 --size 1gb --region $REGION
+//   -w droplets new web2 --size 1gb --region ${REGION}
+//
+//   diocean batch deploy.txt REGION=ams2
+//
+// Lines are the same as those of 'diocean shell'.  $NAME and ${NAME} are
+// replaced before a line is split into words, from the NAME=value arguments,
+// then the NAME=value lines of the script, then the environment; $$ is a
+// '$'.  A line ending in '\' is continued on the next one.  The first
+// failure stops the script, unless --keep-going was given.
+
+type BatchLine struct {
+	Number  int
+	Text    string
+	Status  string
+	Err     error
+	Command string
+}
+
+const (
+	BatchOk      = "ok"
+	BatchFailed  = "failed"
+	BatchSkipped = "skipped"
+)
+
+var batchAssignPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+var batchVarPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+type Batch struct {
+	*LineRunner
+	Lines     []*BatchLine
+	KeepGoing bool
+	// from the command line, they win over the script's
+	Args map[string]string
+	Vars map[string]string
+}
+
+func NewBatch(args []string, keepGoing bool) (*Batch, error) {
+	self := &Batch{
+		LineRunner: NewLineRunner("shell", "batch"),
+		KeepGoing:  keepGoing,
+		Args:       make(map[string]string),
+		Vars:       make(map[string]string),
+	}
+	for _, arg := range args {
+		match := batchAssignPattern.FindStringSubmatch(arg)
+		if match == nil {
+			return nil, UsageError("expected NAME=value, got '%s'", arg)
+		}
+		self.Args[match[1]] = match[2]
+	}
+	return self, nil
+}
+
+// ReadBatchLines reads a script, joining continued lines and dropping blank
+// lines and comments.
+func ReadBatchLines(in io.Reader) ([]*BatchLine, error) {
+	lines := make([]*BatchLine, 0)
+	scanner := bufio.NewScanner(in)
+	var current *BatchLine
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSpace(scanner.Text())
+		if current == nil {
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			current = &BatchLine{Number: number}
+		}
+
+		if strings.HasSuffix(text, "\\") {
+			current.Text += strings.TrimSuffix(text, "\\") + " "
+			continue
+		}
+		current.Text += text
+		lines = append(lines, current)
+		current = nil
+	}
+	if current != nil {
+		lines = append(lines, current)
+	}
+	return lines, scanner.Err()
+}
+
+// Expand replaces the variables in text, an unknown one is an error.
+func (self *Batch) Expand(text string) (string, error) {
+	var err error
+	res := batchVarPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		match := batchVarPattern.FindStringSubmatch(ref)
+		name := match[1] + match[2]
+		if value, ok := self.Args[name]; ok {
+			return value
+		}
+		if value, ok := self.Vars[name]; ok {
+			return value
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		if err == nil {
+			err = UsageError("undefined variable %s", ref)
+		}
+		return ""
+	})
+	return res, err
+}
+
+// RunLine runs one line of the script: an assignment or a command.
+func (self *Batch) RunLine(line *BatchLine) error {
+	if match := batchAssignPattern.FindStringSubmatch(line.Text); match != nil {
+		value, err := self.Expand(match[2])
+		if err != nil {
+			return err
+		}
+		words, err := SplitCommandLine(value)
+		if err != nil {
+			return WithExitCode(ExitUsage, err)
+		}
+		self.Vars[match[1]] = strings.Join(words, " ")
+		line.Command = match[1] + "=" + self.Vars[match[1]]
+		return nil
+	}
+
+	line.Command = line.Text
+	text, err := self.Expand(line.Text)
+	if err != nil {
+		return err
+	}
+	line.Command = text
+	return self.LineRunner.RunLine(text)
+}
+
+// Run runs the lines, returning the first failure.
+func (self *Batch) Run(lines []*BatchLine) error {
+	defer self.Begin()()
+	self.Lines = lines
+
+	var first error
+	for _, line := range lines {
+		if first != nil && !self.KeepGoing {
+			line.Status, line.Command = BatchSkipped, line.Text
+			continue
+		}
+
+		line.Err = self.RunLine(line)
+		if line.Err == nil {
+			line.Status = BatchOk
+			continue
+		}
+		line.Status = BatchFailed
+		ReportError(os.Stderr, fmt.Errorf("line %d: %w", line.Number, line.Err))
+		if first == nil {
+			first = line.Err
+		}
+	}
+
+	if first != nil {
+		failed := 0
+		for _, line := range lines {
+			if line.Status == BatchFailed {
+				failed++
+			}
+		}
+		return &ExitError{Code: ExitCode(first), Err: fmt.Errorf("batch: %d of %d lines failed, the first with: %s", failed, len(lines), first)}
+	}
+	return nil
+}
+
+// WriteSummary lists each line with how it went.
+func (self *Batch) WriteSummary(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "LINE\tSTATUS\tCOMMAND\n")
+	for _, line := range self.Lines {
+		status := line.Status
+		if line.Err != nil {
+			status = fmt.Sprintf("%s (%d)", status, ExitCode(line.Err))
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", line.Number, status, RedactText(line.Command))
+	}
+	tw.Flush()
+}
+
+func DoBatch(route *Route) error {
+	batch, err := NewBatch(route.VarParams["vars"], route.Params["keep_going"] == "true")
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if script := route.Params["script"]; script != "-" {
+		file, err := os.Open(script)
+		if err != nil {
+			return WithExitCode(ExitUsage, err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	lines, err := ReadBatchLines(in)
+	if err != nil {
+		return err
+	}
+
+	err = batch.Run(lines)
+	fmt.Fprintf(os.Stderr, "\n")
+	batch.WriteSummary(os.Stderr)
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadBatchLines(t *testing.T) {
+	lines, err := ReadBatchLines(strings.NewReader(`# create the web servers
+REGION=nyc2
+
+droplets new web1 \
+  --region $REGION
+  # indented comment
+regions ls`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BatchLine{
+		{Number: 2, Text: "REGION=nyc2"},
+		{Number: 4, Text: "droplets new web1  --region $REGION"},
+		{Number: 7, Text: "regions ls"},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("ReadBatchLines => %d lines, expected %d", len(lines), len(expected))
+	}
+	for ii, line := range lines {
+		if line.Number != expected[ii].Number || line.Text != expected[ii].Text {
+			t.Errorf("ReadBatchLines[%d] => %d %q, expected %d %q", ii, line.Number, line.Text, expected[ii].Number, expected[ii].Text)
+		}
+	}
+}
+
+func TestBatchExpand(t *testing.T) {
+	saved, wasSet := os.LookupEnv("DIOCEAN_TEST_SIZE")
+	defer func() {
+		if wasSet {
+			os.Setenv("DIOCEAN_TEST_SIZE", saved)
+		} else {
+			os.Unsetenv("DIOCEAN_TEST_SIZE")
+		}
+	}()
+	os.Setenv("DIOCEAN_TEST_SIZE", "2gb")
+
+	batch, err := NewBatch(SArray("REGION=ams2"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch.Vars["REGION"] = "nyc2"
+	batch.Vars["NAME"] = "web1"
+
+	text, err := batch.Expand("droplets new ${NAME}-$REGION --size $DIOCEAN_TEST_SIZE -o template='{{$$.Name}}'")
+	if err != nil || text != "droplets new web1-ams2 --size 2gb -o template='{{$.Name}}'" {
+		t.Errorf("Expand => %q, %v", text, err)
+	}
+
+	if _, err := batch.Expand("droplets show $DROPLET_ID"); ExitCode(err) != ExitUsage {
+		t.Errorf("Expand with an undefined variable => %v", err)
+	}
+
+	if _, err := NewBatch(SArray("REGION"), false); ExitCode(err) != ExitUsage {
+		t.Errorf("NewBatch(REGION) => %v", err)
+	}
+}
+
+func TestBatchRun(t *testing.T) {
+	InitRoutingTable()
+	savedConfig, savedOptions := Config, CmdlineOptions
+	defer func() { Config, CmdlineOptions = savedConfig, savedOptions }()
+	Config = MockSettings(t, map[string]string{"ClientId": "client-1", "ApiKey": "key-1"})
+	CmdlineOptions.Output = OutputText
+
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	flags.BoolVar(&CmdlineOptions.DryRun, "dry-run", false, "")
+	RegisterRouteOptions(flags)
+
+	script := `SIZE=1gb
+-dry-run droplets new web1 --size $SIZE --region nyc2 --image ubuntu
+droplets frob
+-dry-run droplets new web2 --size $SIZE --region nyc2 --image ubuntu
+shell
+`
+	for _, keepGoing := range []bool{false, true} {
+		lines, _ := ReadBatchLines(strings.NewReader(script))
+		// the options of the batch itself
+		CmdlineOptions.RouteOptions = map[string]string{"keep_going": "true"}
+		batch, _ := NewBatch(nil, keepGoing)
+		batch.Flags = flags
+
+		var err error
+		captureStderr(t, func() { err = batch.Run(lines) })
+		if ExitCode(err) != ExitUsage {
+			t.Errorf("Batch.Run(keepGoing=%t) => %v", keepGoing, err)
+		}
+
+		var summary bytes.Buffer
+		batch.WriteSummary(&summary)
+		expected := []string{"ok", "ok", "failed (2)", "skipped", "skipped"}
+		if keepGoing {
+			expected = []string{"ok", "ok", "failed (2)", "ok", "failed (2)"}
+		}
+		for ii, row := range strings.Split(strings.TrimSpace(summary.String()), "\n")[1:] {
+			if !strings.Contains(row, "  "+expected[ii]+"  ") {
+				t.Errorf("Batch.Run(keepGoing=%t) line %d => %s, expected %s", keepGoing, batch.Lines[ii].Number, row, expected[ii])
+			}
+		}
+		if !strings.Contains(summary.String(), "droplets new web1 --size 1gb") {
+			t.Errorf("Batch summary should show the expanded commands:\n%s", summary.String())
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 var MockApiResponses map[string]string = map[string]string{
 	"DropletSizes": `{"Status":"OK","Sizes":[{"Id":66,"Name":"512MB","Slug":"512mb"},{"Id":63,"Name":"1GB","Slug":"1gb"},{"Id":62,"Name":"2GB","Slug":"2gb"},{"Id":64,"Name":"4GB","Slug":"4gb"},{"Id":65,"Name":"8GB","Slug":"8gb"},{"Id":61,"Name":"16GB","Slug":"16gb"},{"Id":60,"Name":"32GB","Slug":"32gb"},{"Id":70,"Name":"48GB","Slug":"48gb"},{"Id":69,"Name":"64GB","Slug":"64gb"}]}`,
   "RegionsLs": `{"Status":"OK","Regions":[{"Id":3,"Name":"San Francisco 1","Slug":"sfo1"},{"Id":4,"Name":"New York 2","Slug":"nyc2"},{"Id":5,"Name":"Amsterdam 2","Slug":"ams2"},{"Id":6,"Name":"Singapore 1","Slug":"sgp1"}]}`,
+	"DropletsLs":   `{"Status":"OK","Droplets":[{"Id":123,"Name":"web1","Status":"active"},{"Id":456,"Name":"db1","Status":"off"}]}`,
 }
 
 func StringMapKeys(m map[string]string) []string {
@@ -27,7 +28,11 @@ func CreateMockCachedResponse(t *testing.T, name string) {
 		t.Errorf("Error: invalid MockApiResponse: %s => %s", name, StringMapKeys(MockApiResponses))
 	}
 	t.Logf("CreateMockCachedResponse(*, %s) => %s", name, len(content))
-	SaveToDiskCache(Config.CacheFilePath(name+".json"), []byte(content))
+	cacheFile, err := Config.CacheFilePath(name + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SaveToDiskCache(cacheFile, []byte(content))
 }
 
 func StringArraysMatch(left, right []string) bool {
@@ -121,7 +126,7 @@ func TestFindCompletions(t *testing.T) {
 	words := FindCompletionWords(args)
 	t.Logf("TestFindCompletions: args=%s words=%s", args, strings.Join(words, ", "))
 	expected := []string{
-		"droplets", "events", "help", "images", "regions", "sizes", "ssh", "ssh-keys",
+		"batch", "config", "droplets", "events", "help", "images", "profile", "regions", "shell", "sizes", "ssh", "ssh-keys",
 	}
 	if !StringArraysMatch(expected, words) {
 		t.Errorf("FindCompletionWords(%s) :: %s != %s", args, words, expected)
@@ -145,6 +150,14 @@ func TestFindCompletions(t *testing.T) {
 		t.Errorf("FindCompletionWords(%s) :: %s != %s", args, words, expected)
 	}
 
+	args = []string{"images", "transfer", "123", "nyc2", ""}
+	words = FindCompletionWords(args)
+	t.Logf("TestFindCompletions: args=%s words=%s", args, strings.Join(words, ", "))
+	expected = []string{"ams2", "nyc2", "sfo1", "sgp1"}
+	if !StringArraysMatch(expected, words) {
+		t.Errorf("FindCompletionWords(%s) :: %s != %s", args, words, expected)
+	}
+
 	return
 	// TODO this test fails, it should not return anything since the route fully matches
 	args = []string{"droplets", "ls"}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// 'diocean config init|validate|show': writing, checking and explaining the
+// config file.
+
+// CheckCredentials reports the credentials that are given in none of the
+// ways they can be: a value, a command, a file or the environment.
+func CheckCredentials(path string, settings Settings, context string) []error {
+	problems := make([]error, 0)
+	for _, key := range []string{"ClientId", "ApiKey"} {
+		given := os.Getenv(EnvVarFor(key)) != ""
+		for _, setting := range SecretSettingKeys(key) {
+			given = given || settings.IsSet(setting)
+		}
+		if !given {
+			msg := fmt.Sprintf("no %s, set %s, %sCommand, %sFile or $%s", key, key, key, key, EnvVarFor(key))
+			problems = append(problems, &ConfigError{path, context, msg, true})
+		}
+	}
+	return problems
+}
+
+// ValidateConfigFile reports the problems with a config file: unknown
+// settings, values of the wrong type, and missing credentials in the top
+// level settings (when there are no profiles) or in any profile, as it would
+// be used, ie: layered over the top level ones.
+func ValidateConfigFile(path string) []error {
+	file, problems := ReadConfigFile(path)
+	if file == nil {
+		return problems
+	}
+
+	if len(file.Profiles) == 0 {
+		problems = append(problems, CheckCredentials(path, file.Settings, "")...)
+	}
+	for _, name := range ProfileNames(file.Profiles) {
+		config, _ := ApplyProfile(file.Settings, file.Profiles, name)
+		problems = append(problems, CheckCredentials(path, config, "Profiles."+name)...)
+	}
+	return problems
+}
+
+func DoConfigValidate(route *Route) error {
+	path := CmdlineOptions.ConfigPath
+	problems := ValidateConfigFile(path)
+	if len(problems) > 0 {
+		for _, problem := range problems[1:] {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", problem)
+		}
+		return WithExitCode(ExitConfig, problems[0])
+	}
+
+	if route.Params["api"] == "true" {
+		if err := LoadConfig(); err != nil {
+			return WithExitCode(ExitConfig, err)
+		}
+		Client.ClientId, Client.ApiKey = Config.ClientId, Config.ApiKey
+		if _, err := ApiCall("/regions", nil); err != nil {
+			return &ExitError{Code: ExitCode(err), Err: fmt.Errorf("API call with the %s credentials failed: %s", ProfileLabel(), err)}
+		}
+	}
+
+	fmt.Printf("%s: ok\n", path)
+	return nil
+}
+
+func ProfileLabel() string {
+	if ActiveProfile == "" {
+		return "top level"
+	}
+	return "profile " + ActiveProfile
+}
+
+// EffectiveSettings are the settings in use, along with where each came
+// from: the config file, a profile, the environment, a secret command or
+// file, a flag or the built in default.
+func EffectiveSettings() (map[string]string, map[string]string) {
+	settings := Config.Map()
+	sources := make(map[string]string)
+	for key := range settings {
+		sources[key] = ConfigSources[key]
+	}
+
+	if CmdlineOptions.CachePath.IsSet {
+		settings["CacheDirectory"], sources["CacheDirectory"] = CmdlineOptions.CachePath.Value, "-cache.path"
+	} else if _, ok := settings["CacheDirectory"]; !ok {
+		settings["CacheDirectory"], sources["CacheDirectory"] = DefaultCacheDirectory(), "default"
+	}
+
+	if CmdlineOptions.CacheMaxSeconds.IsSet {
+		settings["CacheMaxSeconds"], sources["CacheMaxSeconds"] = fmt.Sprintf("%d", CmdlineOptions.CacheMaxSeconds.Value), "-cache.age"
+	} else if _, ok := settings["CacheMaxSeconds"]; !ok {
+		settings["CacheMaxSeconds"], sources["CacheMaxSeconds"] = fmt.Sprintf("%d", CacheMaxSeconds()), "default"
+	}
+
+	return settings, sources
+}
+
+func WriteSettings(w io.Writer, settings map[string]string, sources map[string]string) {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "SETTING\tVALUE\tSOURCE\n")
+	for _, key := range keys {
+		value := settings[key]
+		if IsSecretSetting(key) {
+			value = RedactSecret(value)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", key, value, sources[key])
+	}
+	tw.Flush()
+}
+
+func DoConfigShow(route *Route) error {
+	err := LoadConfig()
+	fmt.Printf("Config file: %s\n", CmdlineOptions.ConfigPath)
+	fmt.Printf("Profile: %s\n\n", ProfileLabel())
+	settings, sources := EffectiveSettings()
+	WriteSettings(os.Stdout, settings, sources)
+	return WithExitCode(ExitConfig, err)
+}
+
+type configPrompt struct {
+	Key      string
+	Question string
+	Type     ParamType
+	Required bool
+}
+
+var ConfigInitPrompts = []configPrompt{
+	{"ClientId", "Client ID", ParamString, true},
+	{"ApiKey", "API key (leave empty to give a command that prints it)", ParamString, false},
+	{"ApiKeyCommand", "Command that prints the API key, eg: pass show do/prod", ParamString, false},
+	{"DefaultRegion", "Default region, eg: nyc2 (optional)", ParamSlug, false},
+	{"DefaultSize", "Default size, eg: 512mb (optional)", ParamSlug, false},
+	{"DefaultImage", "Default image, eg: ubuntu-14-04-x64 (optional)", ParamIdOrName, false},
+	{"DefaultSshKeyIds", "Default SSH key ids, eg: 12,34 (optional)", ParamIntList, false},
+}
+
+// ConfigInit asks for the settings on in and writes them to path, readable
+// only by the user.
+func ConfigInit(in io.Reader, out io.Writer, path string) error {
+	reader := bufio.NewReader(in)
+	ask := func(question string) (string, error) {
+		fmt.Fprintf(out, "%s: ", question)
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return "", CancelledError("no answer to '%s'", question)
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+	// the API key is not shown as it is typed on a terminal
+	askSecret := func(question string) (string, error) {
+		if in != os.Stdin || !IsTerminal(os.Stdin) {
+			return ask(question)
+		}
+		restore, err := TerminalNoEcho()
+		if err != nil {
+			return ask(question)
+		}
+		defer OnInterrupt(func() {
+			restore()
+			Fail(CancelledError("interrupted"))
+		})()
+		defer fmt.Fprintf(out, "\n")
+		defer restore()
+		return ask(question)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		answer, err := ask(fmt.Sprintf("%s exists, overwrite it? [y/N]", path))
+		if err != nil {
+			return err
+		}
+		if answer != "y" && answer != "yes" {
+			return CancelledError("not overwriting %s", path)
+		}
+	}
+
+	var settings Settings
+	for _, prompt := range ConfigInitPrompts {
+		if prompt.Key == "ApiKeyCommand" && settings.IsSet("ApiKey") {
+			continue
+		}
+		required := prompt.Required || (prompt.Key == "ApiKeyCommand")
+
+		for {
+			read := ask
+			if prompt.Key == "ApiKey" {
+				read = askSecret
+			}
+			value, err := read(prompt.Question)
+			if err != nil {
+				return err
+			}
+			if value == "" && required {
+				fmt.Fprintf(out, "  a value is required\n")
+				continue
+			}
+			if expected := prompt.Type.Expected(value); value != "" && expected != "" {
+				fmt.Fprintf(out, "  expected %s\n", expected)
+				continue
+			}
+			settings.Set(prompt.Key, value)
+			break
+		}
+	}
+
+	content, err := FormatConfigFile(path, settings)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// an existing file keeps its mode with O_CREATE
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Wrote %s\n", path)
+	return nil
+}
+
+func DoConfigInit(route *Route) error {
+	return ConfigInit(os.Stdin, os.Stdout, CmdlineOptions.ConfigPath)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactSecret(t *testing.T) {
+	if res := RedactSecret("abc"); res != "****" {
+		t.Errorf("RedactSecret(abc) => %s", res)
+	}
+	if res := RedactSecret("0123456789abcdef"); res != "****cdef" {
+		t.Errorf("RedactSecret(0123456789abcdef) => %s", res)
+	}
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	InitRoutingTable()
+	dir, err := ioutil.TempDir("", "diocean-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+
+	ioutil.WriteFile(path, []byte(`{"ClientId": "c", "ApiKeyCommand": "pass show do", "DefaultSize": "1gb", "CacheMaxSeconds": 60}`), 0600)
+	if problems := ValidateConfigFile(path); len(problems) != 0 {
+		t.Errorf("ValidateConfigFile(valid) => %s", problems)
+	}
+
+	ioutil.WriteFile(path, []byte(`{
+  "ClientId": "c",
+  "CacheMaxSeconds": "soon",
+  "DefaultSzie": "1gb",
+  "Profiles": {"prod": {"DefaultSshKeyIds": "12;34"}, "staging": {"ApiKey": "k"}}
+}`), 0600)
+	problems := ValidateConfigFile(path)
+	expected := []string{
+		"CacheMaxSeconds: expected an integer, got 'soon'",
+		"DefaultSzie: unknown setting",
+		"Profiles.prod.DefaultSshKeyIds: invalid value '12;34'",
+		"Profiles.prod: no ApiKey",
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("ValidateConfigFile(invalid) => %s", problems)
+	}
+	for _, exp := range expected {
+		found := false
+		for _, problem := range problems {
+			found = found || strings.Contains(problem.Error(), exp)
+		}
+		if !found {
+			t.Errorf("ValidateConfigFile(invalid) did not report '%s': %s", exp, problems)
+		}
+	}
+}
+
+func TestConfigInit(t *testing.T) {
+	InitRoutingTable()
+	dir, err := ioutil.TempDir("", "diocean-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+
+	// no ApiKey, then an invalid region that is asked for again
+	in := strings.NewReader("client-1\n\npass show do\nNew York\nnyc2\n\n\n12,34\n")
+	var out bytes.Buffer
+	if err := ConfigInit(in, &out, path); err != nil {
+		t.Fatalf("ConfigInit => %s\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "expected a slug") {
+		t.Errorf("ConfigInit did not reject the region:\n%s", out.String())
+	}
+
+	finfo, err := os.Stat(path)
+	if err != nil || finfo.Mode().Perm() != 0600 {
+		t.Errorf("ConfigInit file mode => %v %v", finfo, err)
+	}
+
+	content, _ := ioutil.ReadFile(path)
+	var settings map[string]string
+	json.Unmarshal(content, &settings)
+	expected := map[string]string{
+		"ClientId":         "client-1",
+		"ApiKeyCommand":    "pass show do",
+		"DefaultRegion":    "nyc2",
+		"DefaultSshKeyIds": "12,34",
+	}
+	if len(settings) != len(expected) {
+		t.Errorf("ConfigInit wrote %s", content)
+	}
+	for key, value := range expected {
+		if settings[key] != value {
+			t.Errorf("ConfigInit: %s => '%s' expected '%s'", key, settings[key], value)
+		}
+	}
+
+	err = ConfigInit(strings.NewReader("n\n"), &out, path)
+	if err == nil || !strings.Contains(err.Error(), "not overwriting") {
+		t.Errorf("ConfigInit over an existing file => %v", err)
+	}
+}
+
+func TestLoadConfigSources(t *testing.T) {
+	home, err := ioutil.TempDir("", "diocean-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	path := filepath.Join(home, ".digitalocean.json")
+	ioutil.WriteFile(path, []byte(`{"ClientId": "c", "ApiKeyCommand": "echo k", "Profiles": {"prod": {"DefaultRegion": "nyc2"}}}`), 0600)
+
+	savedPath, savedHome, savedFlag := CmdlineOptions.ConfigPath, os.Getenv("HOME"), CmdlineOptions.Profile
+	defer func() {
+		CmdlineOptions.ConfigPath, CmdlineOptions.Profile = savedPath, savedFlag
+		os.Setenv("HOME", savedHome)
+	}()
+	os.Setenv("HOME", home)
+	CmdlineOptions.ConfigPath, CmdlineOptions.Profile = path, "prod"
+
+	withEnv(t, map[string]string{"DIOCEAN_CACHE_MAX_SECONDS": "30"}, func() {
+		if err := LoadConfig(); err != nil {
+			t.Fatalf("LoadConfig => %s", err)
+		}
+	})
+
+	expected := map[string]string{
+		"ClientId":        path,
+		"ApiKey":          "ApiKeyCommand",
+		"DefaultRegion":   path + " profile prod",
+		"CacheMaxSeconds": "$DIOCEAN_CACHE_MAX_SECONDS",
+	}
+	for key, source := range expected {
+		if ConfigSources[key] != source {
+			t.Errorf("ConfigSources[%s] => '%s' expected '%s'", key, ConfigSources[key], source)
+		}
+	}
+
+	var out bytes.Buffer
+	settings, sources := EffectiveSettings()
+	WriteSettings(&out, settings, sources)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "ApiKey" && fields[1] != "****" {
+			t.Errorf("WriteSettings did not redact the ApiKey:\n%s", out.String())
+		}
+	}
+}
@@ -6,8 +6,9 @@ import (
 	"fmt"
 	"github.com/kyleburton/diocean-go"
 	"io/ioutil"
+	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"sort"
 	"strings"
 	"time"
@@ -17,10 +18,6 @@ import (
 
 var Client *diocean.DioceanClient
 
-type ConfigType map[string]string
-
-var Config ConfigType
-
 type TrackedStringFlag struct {
   Value string
   IsSet bool
@@ -63,7 +60,7 @@ func (self *TrackedIntFlag) String () string {
 func (self *TrackedIntFlag) Set (s string) error {
   ii, err := strconv.Atoi(s)
   if err != nil {
-    panic(err)
+    return fmt.Errorf("expected a number, got '%s'", s)
   }
   self.Value = ii
   self.IsSet = true
@@ -79,11 +76,20 @@ type CmdlineOptionsStruct struct {
 	UseDiskCache        bool
   CachePath           TrackedStringFlag
   CacheMaxSeconds     TrackedIntFlag
+	Output              string
+	OutputFormat        string
+	OutputArg           string
+	Filters             StringListFlag
+	Sort                string
+	Quiet               bool
+	RouteOptions        map[string]string
+	DryRun              bool
+	Profile             string
 }
 
 var CmdlineOptions CmdlineOptionsStruct
 
-type RouteHandler func(*Route)
+type RouteHandler func(*Route) error
 type RouteParameterCompletions func(route *Route, param string, word string) []string
 
 type Route struct {
@@ -91,249 +97,276 @@ type Route struct {
 	Params        map[string]string
 	Args          []string
 	Handler       RouteHandler
-	HelpText      *string
+	HelpText      string
+	Examples      []string
+	DocsUrl       string
 	CompletionsFn RouteParameterCompletions
+	Specs         []*ParamSpec
+	VarParams     map[string][]string
+	Options       []*ParamSpec
+	ParamSources  map[string]string
+	Offline       bool
+	// the cached lists the route changes, see Invalidates
+	StaleLists    []string
+	// set for the routes of aliases from the config file
+	Alias         *Alias
 }
 
-var RoutingTable []*Route
-
-func InitRoutingTable() {
-	RoutingTable = make([]*Route, 0)
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern: []string{"sizes", "ls"},
-		Params:  make(map[string]string),
-		Handler: DropletSizesLs,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "ls", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsLsDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "show", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsLsDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "reboot", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsRebootDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "power-cycle", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsPowerCycleDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "shut-down", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsShutDownDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "shutdown", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsShutDownDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "power-off", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsPowerOffDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "poweroff", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsPowerOffDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "power-on", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsPowerOnDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "poweron", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsPowerOnDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "password-reset", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsPasswordResetDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "resize", ":droplet_id", ":size"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsResizeDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "snapshot", ":droplet_id", ":name"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsSnapshotDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "snapshot", ":droplet_id"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsSnapshotDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "new", ":name", ":size", ":image", ":region", ":ssh_key_ids", ":private_networking", ":backups_enabled"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsNewDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "destroy", ":droplet_id", ":scrub_data"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsDestroyDroplet,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"droplets", "ls"},
-		Params:        make(map[string]string),
-		Handler:       DoDropletsLs,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern: []string{"images", "ls"},
-		Params:  make(map[string]string),
-		Handler: DoImagesLs})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"images", "show", ":image_id"},
-		Params:        make(map[string]string),
-		Handler:       DoImageShow,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"images", "destroy", ":image_id"},
-		Params:        make(map[string]string),
-		Handler:       DoImageDestroy,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern:       []string{"images", ":image_id", ":region_id"},
-		Params:        make(map[string]string),
-		Handler:       DoImageTransfer,
-		CompletionsFn: ParameterCompletions,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern: []string{"events", "show", ":event_id"},
-		Params:  make(map[string]string),
-		Handler: DoEventShow,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern: []string{"events", "wait", ":event_id"},
-		Params:  make(map[string]string),
-		Handler: DoEventWait,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern: []string{"regions", "ls"},
-		Params:  make(map[string]string),
-		Handler: DoRegionsLs,
-	})
-
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern: []string{"ssh-keys", "ls"},
-		Params:  make(map[string]string),
-		Handler: DoSshKeysLs,
-	})
+// Copy returns a copy of the route, without any matched parameters, for
+// RouteMatches to fill in.
+func (self *Route) Copy() *Route {
+	res := *self
+	res.Params = make(map[string]string)
+	res.VarParams = make(map[string][]string)
+	res.ParamSources = make(map[string]string)
+	res.Args = nil
+	return &res
+}
 
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern: []string{"ssh", "fix-known-hosts"},
-		Params:  make(map[string]string),
-		Handler: DoSshFixKnownHosts,
-	})
+// Describe sets the route's help text, a link to its API documentation and
+// usage examples.
+func (self *Route) Describe(helpText, docsUrl string, examples ...string) *Route {
+	self.HelpText = helpText
+	self.DocsUrl = docsUrl
+	self.Examples = examples
+	return self
+}
 
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern: []string{"ssh", ":droplet_name"},
-		Params:  make(map[string]string),
-		Handler: DoSshToDroplet,
-    CompletionsFn: ParameterCompletions,
-	})
+// WithoutApi marks a route that only deals with local state, eg: the
+// profiles, it runs even when the config has no usable credentials.
+func (self *Route) WithoutApi() *Route {
+	self.Offline = true
+	return self
+}
 
-	RoutingTable = append(RoutingTable, &Route{
-		Pattern: []string{"help"},
-		Params:  make(map[string]string),
-		Handler: ShowGeneralHelp,
-	})
+// Invalidates names the cached lists, see lookupPaths, that the route
+// changes, eg: 'droplets new' the droplets.  They are dropped once it has
+// run, so that completion doesn't offer what is gone or miss what is new.
+func (self *Route) Invalidates(names ...string) *Route {
+	self.StaleLists = names
+	return self
 }
 
-func ShowGeneralHelp(route *Route) {
-	fmt.Printf("diocean <command> [arg1 [arg2 ..]] \n")
-	fmt.Printf("  Commands:\n")
-	for _, route := range RoutingTable {
-		fmt.Printf("    %s\n", strings.Join(route.Pattern, "\t"))
-		if route.HelpText != nil {
-			fmt.Printf("\n")
-			fmt.Print(route.HelpText)
-			fmt.Printf("\n")
-		}
+var RoutingTable []*Route
+
+func InitRoutingTable() {
+	dropletsDocs := ApiDocsUrl + "/droplets/"
+	imagesDocs := ApiDocsUrl + "/images/"
+	eventsDocs := ApiDocsUrl + "/events/"
+
+	RoutingTable = []*Route{
+		NewRoute("sizes ls", DropletSizesLs).Describe(
+			"List the available droplet sizes.",
+			ApiDocsUrl+"/sizes/",
+			"diocean sizes ls"),
+		NewRoute("droplets ls", DoDropletsLsDroplet, DropletIdParam).Describe(
+			"Show a droplet, same as 'droplets show'.",
+			dropletsDocs,
+			"diocean droplets ls 123456"),
+		NewRoute("droplets show", DoDropletsLsDroplet, DropletIdParam).Describe(
+			"Show a droplet.",
+			dropletsDocs,
+			"diocean droplets show 123456",
+			"diocean -o json droplets show 123456"),
+		NewRoute("droplets reboot", DoDropletsRebootDroplet, Variadic(DropletIdParam)).Describe(
+			"Reboot one or more droplets.\nThis is the preferred way to restart a droplet, see 'droplets power-cycle'.",
+			dropletsDocs,
+			"diocean -w droplets reboot 123456 234567"),
+		NewRoute("droplets power-cycle", DoDropletsPowerCycleDroplet, Variadic(DropletIdParam)).Describe(
+			"Power cycle one or more droplets, turning them off and back on.",
+			dropletsDocs,
+			"diocean droplets power-cycle 123456"),
+		NewRoute("droplets shut-down", DoDropletsShutDownDroplet, Variadic(DropletIdParam)).Describe(
+			"Shut down one or more droplets.\nThe droplets are still billed while they are off.",
+			dropletsDocs,
+			"diocean -w droplets shut-down 123456"),
+		NewRoute("droplets shutdown", DoDropletsShutDownDroplet, Variadic(DropletIdParam)).Describe(
+			"Shut down one or more droplets, same as 'droplets shut-down'.",
+			dropletsDocs,
+			"diocean droplets shutdown 123456"),
+		NewRoute("droplets power-off", DoDropletsPowerOffDroplet, Variadic(DropletIdParam)).Describe(
+			"Power off one or more droplets, as if pulling the plug.",
+			dropletsDocs,
+			"diocean -w droplets power-off 123456"),
+		NewRoute("droplets poweroff", DoDropletsPowerOffDroplet, Variadic(DropletIdParam)).Describe(
+			"Power off one or more droplets, same as 'droplets power-off'.",
+			dropletsDocs,
+			"diocean droplets poweroff 123456"),
+		NewRoute("droplets power-on", DoDropletsPowerOnDroplet, Variadic(DropletIdParam)).Describe(
+			"Power on one or more droplets.",
+			dropletsDocs,
+			"diocean -w droplets power-on 123456"),
+		NewRoute("droplets poweron", DoDropletsPowerOnDroplet, Variadic(DropletIdParam)).Describe(
+			"Power on one or more droplets, same as 'droplets power-on'.",
+			dropletsDocs,
+			"diocean droplets poweron 123456"),
+		NewRoute("droplets password-reset", DoDropletsPasswordResetDroplet, DropletIdParam).Describe(
+			"Reset the root password of a droplet.\nThe new password is emailed to the account owner.",
+			dropletsDocs,
+			"diocean droplets password-reset 123456"),
+		NewRoute("droplets resize", DoDropletsResizeDroplet, DropletIdParam, SizeParam).Invalidates("DropletsLs").Describe(
+			"Resize a droplet.\nThe droplet must be powered off first.",
+			dropletsDocs,
+			"diocean -w droplets power-off 123456 && diocean -w droplets resize 123456 2gb"),
+		NewRoute("droplets snapshot", DoDropletsSnapshotDroplet, DropletIdParam, Optional(SnapshotNameParam)).Invalidates("ImagesLs").Describe(
+			"Take a snapshot of a droplet.\nThe droplet is powered off for the snapshot, without a name the API picks one.",
+			dropletsDocs,
+			"diocean -w droplets snapshot 123456 web1-before-upgrade"),
+		NewRoute("droplets new", DoDropletsNewDroplet,
+			NewDropletNameParam, Optional(SizeParam), Optional(ImageParam), Optional(RegionParam),
+			Optional(SshKeyIdsParam), Optional(PrivateNetworkingParam), Optional(BackupsEnabledParam)).WithOptions(
+			SizeParam, ImageParam, RegionParam,
+			Optional(SshKeyIdsParam), PrivateNetworkingParam, BackupsEnabledParam).Invalidates("DropletsLs").Describe(
+			"Create a new droplet.\nParameters after the name may also be given as --size, --image, --region,\n--ssh-keys, --private-networking and --backups-enabled, or left to the\nDefaultSize, DefaultImage, ... entries of the config file.",
+			dropletsDocs,
+			"diocean -w droplets new web1 512mb ubuntu-14-04-x64 nyc2 12,34 false false",
+			"diocean droplets new web1 --size 1gb --image ubuntu-14-04-x64 --region nyc2 --ssh-keys 12,34 --private-networking"),
+		NewRoute("droplets destroy", DoDropletsDestroyDroplet, DropletIdParam, Optional(ScrubDataParam)).Invalidates("DropletsLs").Describe(
+			"Destroy a droplet.\nThis can not be undone.",
+			dropletsDocs,
+			"diocean -w droplets destroy 123456",
+			"diocean droplets destroy 123456 true"),
+		NewRoute("droplets ls", DoDropletsLs).Describe(
+			"List the active droplets.",
+			dropletsDocs,
+			"diocean droplets ls",
+			"diocean droplets ls --filter status=active --sort name"),
+		NewRoute("images ls", DoImagesLs).Describe(
+			"List the available images, both public images and your own snapshots.",
+			imagesDocs,
+			"diocean images ls --filter public=false"),
+		NewRoute("images show", DoImageShow, ImageIdParam).Describe(
+			"Show an image.",
+			imagesDocs,
+			"diocean images show 3240036"),
+		NewRoute("images destroy", DoImageDestroy, Variadic(ImageIdParam)).Invalidates("ImagesLs").Describe(
+			"Destroy one or more of your images.\nThis can not be undone.",
+			imagesDocs,
+			"diocean images destroy 3240036"),
+		NewRoute("images transfer", DoImageTransfer, ImageIdParam, Variadic(RegionParam)).Invalidates("ImagesLs").Describe(
+			"Copy an image to one or more other regions.\nWith -w each transfer is waited on before the next one is started.",
+			imagesDocs,
+			"diocean -w images transfer 3240036 nyc2 ams2"),
+		NewRoute("events show", DoEventShow, EventIdParam).Describe(
+			"Show the status of an event.",
+			eventsDocs,
+			"diocean events show 7501"),
+		NewRoute("events wait", DoEventWait, Variadic(EventIdParam)).Describe(
+			"Wait for one or more events to complete.",
+			eventsDocs,
+			"diocean events wait $(diocean -q droplets reboot 123456)"),
+		NewRoute("regions ls", DoRegionsLs).Describe(
+			"List the available regions.",
+			ApiDocsUrl+"/regions/",
+			"diocean regions ls"),
+		NewRoute("ssh-keys ls", DoSshKeysLs).Describe(
+			"List the SSH keys on the account.",
+			ApiDocsUrl+"/ssh-keys/",
+			"diocean ssh-keys ls"),
+		NewRoute("ssh fix-known-hosts", DoSshFixKnownHosts).Describe(
+			"Fix up the ~/.ssh/known_hosts entries for your droplets.",
+			"",
+			"diocean ssh fix-known-hosts"),
+		NewRoute("ssh", DoSshToDroplet, DropletNameParam).Describe(
+			"Open an ssh session as root on a droplet, found by name.",
+			"",
+			"diocean ssh web1"),
+		NewRoute("profile ls", DoProfileLs).WithoutApi().Describe(
+			"List the profiles in the config file, the current one is marked with '*'.",
+			"",
+			"diocean profile ls"),
+		NewRoute("profile use", DoProfileUse, ProfileParam).WithoutApi().Describe(
+			"Make a profile the current one, -profile and DIOCEAN_PROFILE still take precedence.",
+			"",
+			"diocean profile use prod"),
+		NewRoute("config init", DoConfigInit).WithoutApi().Describe(
+			"Write a new config file, asking for each setting.\nThe file is only readable by you.",
+			"",
+			"diocean config init",
+			"diocean -c ~/.digitalocean-staging.json config init"),
+		NewRoute("config validate", DoConfigValidate).WithOptions(ApiCheckParam).WithoutApi().Describe(
+			"Check the config file, and each of its profiles, for unknown settings,\nvalues of the wrong type and missing credentials.\nWith --api an API call is made to check the credentials.",
+			"",
+			"diocean config validate",
+			"diocean -profile prod config validate --api"),
+		NewRoute("config show", DoConfigShow).WithoutApi().Describe(
+			"Show the settings in use and where each came from, secrets are redacted.",
+			"",
+			"diocean config show",
+			"diocean -profile prod config show"),
+		NewRoute("shell", DoShell).Describe(
+			"Run commands one per line, with tab completion and history.\nThe config is loaded once, each line takes the same flags as the command line\nfor that line only, eg: -w droplets reboot 123456.  'exit' or ^D to quit.",
+			"",
+			"diocean shell",
+			"diocean -profile prod shell"),
+		NewRoute("batch", DoBatch, BatchScriptParam, Optional(Variadic(BatchVarParam))).WithOptions(KeepGoingParam).Describe(
+			"Run the commands in a file, one per line, with a summary of how each went.\nLines are as in 'diocean shell', $NAME or ${NAME} is replaced with a NAME=value\nargument, a NAME=value line of the script or an environment variable.\nThe first failure stops the script unless --keep-going is given.",
+			"",
+			"diocean batch deploy.txt",
+			"diocean batch --keep-going deploy.txt REGION=ams2 SIZE=2gb",
+			"generate-commands | diocean batch -"),
+		NewRoute("help", ShowGeneralHelp, Optional(Variadic(CommandParam))).WithoutApi().Describe(
+			"List the commands, or show the details of one.",
+			"",
+			"diocean help",
+			"diocean help droplets new"),
 	}
 }
 
+
+// RouteMatches matches the args against the route's pattern.  Besides literal
+// words a pattern may have required (:name), optional ([:name]) and, as its
+// last part, variadic (:name...) parameters.  Every arg has to be consumed
+// for the route to match.
 func RouteMatches(route *Route, args []string) (*Route, bool) {
-	if CmdlineOptions.Verbose {
-		fmt.Fprintf(os.Stderr, "Route: %s args: %s\n", route, args)
-	}
-	if len(args) < len(route.Pattern) {
-		return nil, false
-	}
-	var res *Route = &Route{
-		Pattern:       route.Pattern,
-		Params:        make(map[string]string),
-		Handler:       route.Handler,
-		CompletionsFn: route.CompletionsFn,
-	}
+	Debugf("Route: %s args: %s\n", strings.Join(route.Pattern, " "), args)
+	var res *Route = route.Copy()
 
-	for idx, part := range route.Pattern {
-		arg := args[idx]
+	idx := 0
+	for _, part := range route.Pattern {
+		arg := ""
 		res.Args = args[idx:]
+		if idx < len(args) {
+			arg = args[idx]
+		}
 		if CmdlineOptions.Verbose {
 			fmt.Fprintf(os.Stderr, "  part:%s arg:%s rest:%s\n", part, arg, res.Args)
 		}
+
+		if IsOptionalParam(part) {
+			if idx < len(args) {
+				res.Params[PatternParamName(part)] = arg
+				idx++
+				if IsVariadicParam(part) {
+					res.VarParams[PatternParamName(part)] = args[idx-1:]
+					idx = len(args)
+				}
+			}
+			continue
+		}
+
+		if idx >= len(args) {
+			if CmdlineOptions.Verbose {
+				fmt.Fprintf(os.Stderr, "  ran out of args at idx=%d, no match\n", idx)
+			}
+			return nil, false
+		}
+
+		if IsVariadicParam(part) {
+			res.Params[PatternParamName(part)] = arg
+			res.VarParams[PatternParamName(part)] = args[idx:]
+			idx = len(args)
+			continue
+		}
+
 		if IsPatternParam(part) {
-			res.Params[part[1:]] = arg
+			res.Params[PatternParamName(part)] = arg
+			idx++
 			continue
 		}
 
 		if part == arg {
+			idx++
 			continue
 		}
 
@@ -343,30 +376,48 @@ func RouteMatches(route *Route, args []string) (*Route, bool) {
 		return nil, false
 	}
 
+	if idx < len(args) {
+		if CmdlineOptions.Verbose {
+			fmt.Fprintf(os.Stderr, "  unexpected trailing args: %s, no match\n", args[idx:])
+		}
+		return nil, false
+	}
+
 	return res, true
 }
 
+// TrailingArgsError explains a failed match where a route would have matched
+// if not for extra arguments at the end of the command line.
+func TrailingArgsError(args []string) error {
+	for nn := len(args) - 1; nn > 0; nn-- {
+		route := FindMatchingRoute(args[:nn])
+		if route != nil {
+			return fmt.Errorf("%s: unexpected argument(s): %s", strings.Join(route.CommandWords(), " "), strings.Join(args[nn:], " "))
+		}
+	}
+	return nil
+}
+
+// FindMatchingRoute returns the most specific route matching the args, see
+// CompareSpecificity.  Table order only breaks ties.
 func FindMatchingRoute(args []string) *Route {
+	var best *Route
 	for _, route := range RoutingTable {
 		res, matched := RouteMatches(route, args)
-		if matched {
-			return res
+		if !matched {
+			continue
+		}
+		if best == nil || CompareSpecificity(res.Pattern, best.Pattern) > 0 {
+			best = res
 		}
 	}
-	return nil
+	return best
 }
 
 func RoutePseudoMatches(route *Route, args []string) (*Route, bool) {
-	if CmdlineOptions.Verbose {
-		fmt.Fprintf(os.Stderr, "RoutePseudoMatches: %s args: %s\n", route, args)
-	}
+	Debugf("RoutePseudoMatches: %s args: %s\n", strings.Join(route.Pattern, " "), args)
 
-	var res *Route = &Route{
-		Pattern:       route.Pattern,
-		Params:        make(map[string]string),
-		Handler:       route.Handler,
-		CompletionsFn: route.CompletionsFn,
-	}
+	var res *Route = route.Copy()
 
 	var arg string
 	// args may be: ()
@@ -419,120 +470,237 @@ func FindPotentialRoutes(args []string) []*Route {
 	return matchingRoutes
 }
 
-func InitConfig() bool {
-	file, e := ioutil.ReadFile(CmdlineOptions.ConfigPath)
-	if e != nil {
-		fmt.Fprintf(os.Stderr, "File error: %v\n", e)
-		return false
+// ConfigSources records where each setting in Config came from, eg: the
+// config file, a profile or an environment variable.
+var ConfigSources map[string]string
+
+// LoadConfig reads the config file and layers the selected profile, the
+// environment and the secret commands and files on top of it, see
+// 'diocean config show'.
+func LoadConfig() error {
+	Config = Settings{}
+	ConfigSources = make(map[string]string)
+	Profiles = make(map[string]Settings)
+	path := CmdlineOptions.ConfigPath
+
+	// the config file is optional when the environment has the credentials
+	var settings Settings
+	file, problems := ReadConfigFile(path)
+	if file == nil {
+		err := problems[0]
+		if !(os.IsNotExist(err) && EnvHasCredentials()) {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s does not exist, run 'diocean config init' or set DIOCEAN_CLIENT_ID and DIOCEAN_API_KEY", path)
+			}
+			return err
+		}
+	} else {
+		if err := FirstFatal(problems); err != nil {
+			return err
+		}
+		settings, Profiles = file.Settings, file.Profiles
 	}
+	RecordConfigSources(Settings{}, settings, path)
 
-	json.Unmarshal(file, &Config)
+	ActiveProfile = SelectProfile()
+	config, err := ApplyProfile(settings, Profiles, ActiveProfile)
+	if err != nil {
+		return err
+	}
+	RecordConfigSources(settings, config, path+" profile "+ActiveProfile)
+
+	Config, err = ApplyEnvOverrides(config, ActiveProfile)
+	if err != nil {
+		return err
+	}
+	for _, override := range EnvOverrides {
+		if os.Getenv(override.Env) != "" {
+			ConfigSources[override.Key] = "$" + override.Env
+		}
+	}
 
-	if _, ok := Config["ClientId"]; !ok {
-		fmt.Fprintf(os.Stderr, "Error: No ClienId in configuration file!\n", e)
-		return false
+	resolved, err := ResolveSecrets(Config)
+	if err != nil {
+		return err
+	}
+	for _, key := range SecretKeys {
+		if resolved.Get(key) != Config.Get(key) {
+			if Config.IsSet(key + "Command") {
+				ConfigSources[key] = key + "Command"
+			} else {
+				ConfigSources[key] = key + "File"
+			}
+		}
 	}
+	Config = resolved
 
-	if _, ok := Config["ApiKey"]; !ok {
-		fmt.Fprintf(os.Stderr, "Error: No ApiKey in configuration file!\n", e)
-		return false
+	for _, key := range []string{"ClientId", "ApiKey"} {
+		if !Config.IsSet(key) {
+			return fmt.Errorf("no %s: set %s, %sCommand or %sFile in %s, or $%s", key, key, key, key, path, EnvVarFor(key))
+		}
 	}
 
-	return true
+	return nil
+}
+
+// RecordConfigSources notes the source of the settings that were added or
+// changed from before to after.
+func RecordConfigSources(before, after Settings, source string) {
+	for _, key := range SettingKeys() {
+		if value := after.Get(key); value != "" && value != before.Get(key) {
+			ConfigSources[key] = source
+		}
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-func DropletSizesLs(route *Route) {
-	Client.DropletSizesLs()
+func DropletSizesLs(route *Route) error {
+	return EmitListResponse([]string{"id", "name", "slug"}, ListCall("DropletSizes", &diocean.DropletSizesResponse{}), Client.DropletSizesLs)
 }
 
-func DoDropletsLsDroplet(route *Route) {
-	Client.DoDropletsLsDroplet(route.Params["droplet_id"])
+func DoDropletsLsDroplet(route *Route) error {
+	return EmitApiCall("/droplets/"+route.Params["droplet_id"], nil, func() {
+		Client.DoDropletsLsDroplet(route.Params["droplet_id"])
+	})
 }
 
-func DoDropletsRebootDroplet(route *Route) {
-	Client.DoDropletsRebootDroplet(route.Params["droplet_id"])
+func DoDropletsRebootDroplet(route *Route) error {
+	for _, dropletId := range route.ParamValues("droplet_id") {
+		err := EmitApiCall("/droplets/"+dropletId+"/reboot", nil, func() {
+			Client.DoDropletsRebootDroplet(dropletId)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func DoDropletsPowerCycleDroplet(route *Route) {
-	Client.DoDropletsPowerCycleDroplet(route.Params["droplet_id"])
+func DoDropletsPowerCycleDroplet(route *Route) error {
+	for _, dropletId := range route.ParamValues("droplet_id") {
+		err := EmitApiCall("/droplets/"+dropletId+"/power_cycle", nil, func() {
+			Client.DoDropletsPowerCycleDroplet(dropletId)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func DoDropletsShutDownDroplet(route *Route) {
-	Client.DoDropletsShutDownDroplet(route.Params["droplet_id"])
+func DoDropletsShutDownDroplet(route *Route) error {
+	for _, dropletId := range route.ParamValues("droplet_id") {
+		err := EmitApiCall("/droplets/"+dropletId+"/shutdown", nil, func() {
+			Client.DoDropletsShutDownDroplet(dropletId)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func DoDropletsPowerOffDroplet(route *Route) {
-	Client.DoDropletsPowerOffDroplet(route.Params["droplet_id"])
+func DoDropletsPowerOffDroplet(route *Route) error {
+	for _, dropletId := range route.ParamValues("droplet_id") {
+		err := EmitApiCall("/droplets/"+dropletId+"/power_off", nil, func() {
+			Client.DoDropletsPowerOffDroplet(dropletId)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func DoDropletsPowerOnDroplet(route *Route) {
-	Client.DoDropletsPowerOnDroplet(route.Params["droplet_id"])
+func DoDropletsPowerOnDroplet(route *Route) error {
+	for _, dropletId := range route.ParamValues("droplet_id") {
+		err := EmitApiCall("/droplets/"+dropletId+"/power_on", nil, func() {
+			Client.DoDropletsPowerOnDroplet(dropletId)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func DoDropletsPasswordResetDroplet(route *Route) {
-	Client.DoDropletsPasswordResetDroplet(route.Params["droplet_id"])
+func DoDropletsPasswordResetDroplet(route *Route) error {
+	return EmitApiCall("/droplets/"+route.Params["droplet_id"]+"/password_reset", nil, func() {
+		Client.DoDropletsPasswordResetDroplet(route.Params["droplet_id"])
+	})
 }
 
-func DoDropletsResizeDroplet(route *Route) {
-	Client.DoDropletsResizeDroplet(route.Params["droplet_id"], route.Params["size"])
+func DoDropletsResizeDroplet(route *Route) error {
+	params := url.Values{}
+	SetSlugOrId(params, "size", route.Params["size"])
+	return EmitApiCall("/droplets/"+route.Params["droplet_id"]+"/resize", params, func() {
+		Client.DoDropletsResizeDroplet(route.Params["droplet_id"], route.Params["size"])
+	})
 }
 
-func DoDropletsSnapshotDroplet(route *Route) {
-	Client.DoDropletsSnapshotDroplet(route.Params["droplet_id"], route.Params["name"])
+func DoDropletsSnapshotDroplet(route *Route) error {
+	params := url.Values{}
+	if route.Params["name"] != "" {
+		params.Set("name", route.Params["name"])
+	}
+	return EmitApiCall("/droplets/"+route.Params["droplet_id"]+"/snapshot", params, func() {
+		Client.DoDropletsSnapshotDroplet(route.Params["droplet_id"], route.Params["name"])
+	})
 }
 
-func DoDropletsNewDroplet(route *Route) {
-	Client.DoDropletsNewDroplet(
-		route.Params["name"],
-		route.Params["size"],
-		route.Params["image"],
-		route.Params["region"],
-		route.Params["ssh_key_ids"],
-		route.Params["private_networking"],
-		route.Params["backups_enabled"],
-	)
+func DoDropletsNewDroplet(route *Route) error {
+	params := url.Values{}
+	params.Set("name", route.Params["name"])
+	SetSlugOrId(params, "size", route.Params["size"])
+	SetSlugOrId(params, "image", route.Params["image"])
+	SetSlugOrId(params, "region", route.Params["region"])
+	params.Set("ssh_key_ids", route.Params["ssh_key_ids"])
+	params.Set("private_networking", route.Params["private_networking"])
+	params.Set("backups_enabled", route.Params["backups_enabled"])
+	return EmitApiCall("/droplets/new", params, func() {
+		Client.DoDropletsNewDroplet(
+			route.Params["name"],
+			route.Params["size"],
+			route.Params["image"],
+			route.Params["region"],
+			route.Params["ssh_key_ids"],
+			route.Params["private_networking"],
+			route.Params["backups_enabled"],
+		)
+	})
 }
 
-func EnsureDirectory(path string) {
+func EnsureDirectory(path string) error {
 	_, err := os.Stat(path)
 	if err != nil && os.IsNotExist(err) {
-		err = os.MkdirAll(path, 0755)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error[MkdirAll(%s): %s\n", path, err)
-			os.Exit(1)
-		}
-	}
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error[Stat(%s)]: %s\n", path, err)
-		os.Exit(1)
+		return os.MkdirAll(path, 0755)
 	}
-
+	return err
 }
 
 // cache.path flag overrides
 // config file overrides
 // default: ~/.digitalocean/cache
-func (self ConfigType) CacheFilePath(f string) string {
+func (self *Settings) CacheFilePath(f string) (string, error) {
   var cachePath string
 
   if CmdlineOptions.CachePath.IsSet {
     cachePath = CmdlineOptions.CachePath.Value
   } else {
-    var hasCachePath bool
-    cachePath, hasCachePath = Config["CacheDirectory"]
-    if !hasCachePath {
-      cachePath = os.Getenv("HOME") + "/.digitalocean/cache"
+    cachePath = self.CacheDirectory
+    if cachePath == "" {
+      cachePath = DefaultCacheDirectory()
     }
   }
 
-	EnsureDirectory(cachePath)
+	if err := EnsureDirectory(cachePath); err != nil {
+		return "", err
+	}
 
-	return cachePath + "/" + f
+	return cachePath + "/" + f, nil
 }
 
-type PerformCall func() interface{}
+type PerformCall func() (interface{}, error)
 
 func ReadFromDiskCache(cacheFile string) (body []byte, age int64, existed bool, err error) {
 	finfo, err := os.Stat(cacheFile)
@@ -558,13 +726,12 @@ func SaveToDiskCache(cacheFile string, body []byte) error {
 }
 
 func RemoveFromDiskCache(name string) error {
-	cacheFile := Config.CacheFilePath(name + ".json")
-	err := os.Remove(cacheFile)
+	cacheFile, err := Config.CacheFilePath(name + ".json")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-		os.Exit(1)
+		return err
 	}
-	return nil
+	delete(MemoryCache, cacheFile)
+	return os.Remove(cacheFile)
 }
 
 func CacheMaxSeconds () int {
@@ -572,44 +739,104 @@ func CacheMaxSeconds () int {
     return CmdlineOptions.CacheMaxSeconds.Value
   }
 
-  nn, isSet := Config["CacheMaxSeconds"]
-  if isSet {
-    ii, err := strconv.Atoi(nn)
-    if err != nil {
-      panic(err)
-    }
-    return ii
+  if Config.CacheMaxSeconds != nil {
+    return *Config.CacheMaxSeconds
   }
 
   return 600
 }
 
-func UseDiskCache(name string, maxAgeSeconds int, fn PerformCall) []byte {
-	cacheFile := Config.CacheFilePath(name + ".json")
+type memoryCacheEntry struct {
+	Body    []byte
+	Fetched time.Time
+}
 
-	body, age, existed, err := ReadFromDiskCache(cacheFile)
+// MemoryCache keeps the responses read through UseDiskCache for the life of
+// the process, eg: so completions in 'diocean shell' don't go back to the
+// disk.  It is keyed by cache file, so profiles are kept apart.
+var MemoryCache = make(map[string]memoryCacheEntry)
 
+func UseDiskCache(name string, maxAgeSeconds int, fn PerformCall) ([]byte, error) {
+	cacheFile, err := Config.CacheFilePath(name + ".json")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-		os.Exit(1)
+		return nil, err
 	}
 
+	maxAge := time.Duration(maxAgeSeconds) * time.Second
+	if entry, ok := MemoryCache[cacheFile]; ok && time.Since(entry.Fetched) <= maxAge {
+		return entry.Body, nil
+	}
+
+	body, age, existed, err := ReadFromDiskCache(cacheFile)
+	if err != nil {
+		return nil, err
+	}
+	fetched := time.Now().Add(-time.Duration(age) * time.Second)
+
 	if !existed || age > int64(maxAgeSeconds) {
-		// cache it
-		res := fn()
-		body, err := json.Marshal(res)
+		// cache it, responses may echo the request
+		res, err := fn()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-			os.Exit(1)
+			return nil, err
 		}
-		err = SaveToDiskCache(cacheFile, body)
+		body, err = json.Marshal(res)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-			os.Exit(1)
+			return nil, err
+		}
+		body = []byte(RedactText(string(body)))
+		if err = SaveToDiskCache(cacheFile, body); err != nil {
+			return nil, err
 		}
+		fetched = time.Now()
 	}
 
-	return body
+	MemoryCache[cacheFile] = memoryCacheEntry{body, fetched}
+	return body, nil
+}
+
+// lookupPaths are the lists completions and slug lookups read, cached under
+// the name of the client library call each one used to be.
+var lookupPaths = map[string]string{
+	"DropletSizes": "/sizes/",
+	"ImagesLs":     "/images/",
+	"RegionsLs":    "/regions/",
+	"SshKeysLs":    "/ssh_keys/",
+	"DropletsLs":   "/droplets/",
+}
+
+// LookupList reads one of the lookupPaths lists, through the disk cache,
+// into resp, eg: &diocean.RegionResponse{}.
+func LookupList(name string, resp interface{}) error {
+	body, err := UseDiskCache(name, CacheMaxSeconds(), ApiList(lookupPaths[name], resp))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, resp)
+}
+
+// ListCall is the fetchFn of a list command.  In the shell the list is kept
+// in the cache too, so that completion afterwards finds what was just
+// listed.
+func ListCall(name string, resp interface{}) PerformCall {
+	if !InShell {
+		return ApiList(lookupPaths[name], resp)
+	}
+	return func() (interface{}, error) {
+		// refreshed, rather than read from the cache
+		RemoveFromDiskCache(name)
+		if err := LookupList(name, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// CachedLookup is LookupList for completions, which offer nothing when the
+// API or the cache fails.
+func CachedLookup(name string, resp interface{}) {
+	if err := LookupList(name, resp); err != nil {
+		Debugf("CachedLookup[%s]: %s\n", name, err)
+	}
 }
 
 func ParameterCompletions(route *Route, param, word string) []string {
@@ -625,18 +852,16 @@ func ParameterCompletions(route *Route, param, word string) []string {
 	case ":size":
 		// this should be cached out to disk...
 		// resp := Client.DropletSizes()
-		body := UseDiskCache("DropletSizes", CacheMaxSeconds(), func() interface{} { return Client.DropletSizes() })
 		var resp diocean.DropletSizesResponse
-		resp.Unmarshal(body)
+		CachedLookup("DropletSizes", &resp)
 		for _, info := range resp.Sizes {
 			words = append(words, info.Slug)
 		}
 	case ":image":
 		// this should be cached out to disk...
 		//resp := Client.ImagesLs()
-		body := UseDiskCache("ImagesLs", CacheMaxSeconds(), func() interface{} { return Client.ImagesLs() })
 		var resp diocean.ImagesResponse
-		resp.Unmarshal(body)
+		CachedLookup("ImagesLs", &resp)
 		for _, info := range resp.Images {
 			var w string = ""
 
@@ -653,9 +878,8 @@ func ParameterCompletions(route *Route, param, word string) []string {
 	case ":image_id":
 		// this should be cached out to disk...
 		// resp := Client.ImagesLs()
-		body := UseDiskCache("ImagesLs", CacheMaxSeconds(), func() interface{} { return Client.ImagesLs() })
 		var resp diocean.ImagesResponse
-		resp.Unmarshal(body)
+		CachedLookup("ImagesLs", &resp)
 		for _, info := range resp.Images {
 			var w string = ""
 			w = fmt.Sprintf("%.f", info.Id)
@@ -663,44 +887,44 @@ func ParameterCompletions(route *Route, param, word string) []string {
 		}
 	case ":region":
 		//resp := Client.RegionsLs()
-		body := UseDiskCache("RegionsLs", CacheMaxSeconds(), func() interface{} { return Client.RegionsLs() })
 		var resp diocean.RegionResponse
-		resp.Unmarshal(body)
+		CachedLookup("RegionsLs", &resp)
 		for _, region := range resp.Regions {
 			words = append(words, region.Slug)
 		}
 	case ":region_id":
 		//resp := Client.RegionsLs()
-		body := UseDiskCache("RegionsLs", CacheMaxSeconds(), func() interface{} { return Client.RegionsLs() })
 		var resp diocean.RegionResponse
-		resp.Unmarshal(body)
+		CachedLookup("RegionsLs", &resp)
 		for _, region := range resp.Regions {
 			words = append(words, fmt.Sprintf("%.f", region.Id))
 		}
 	case ":ssh_key_ids":
 		//resp := Client.SshKeysLs()
-		body := UseDiskCache("SshKeysLs", CacheMaxSeconds(), func() interface{} { return Client.SshKeysLs() })
 		var resp diocean.SshKeysResponse
-		resp.Unmarshal(body)
+		CachedLookup("SshKeysLs", &resp)
+		if resp.Ssh_keys == nil {
+			break
+		}
 		for _, info := range *resp.Ssh_keys {
 			words = append(words, fmt.Sprintf("%.f", info.Id))
 		}
 	case ":droplet_id":
 		// resp := Client.DropletsLs()
-		body := UseDiskCache("DropletsLs", CacheMaxSeconds(), func() interface{} { return *Client.DropletsLs() })
 		var resp diocean.ActiveDropletsResponse
-		resp.Unmarshal(body)
+		CachedLookup("DropletsLs", &resp)
 		for _, info := range resp.Droplets {
 			words = append(words, fmt.Sprintf("%.f", info.Id))
 		}
   case ":droplet_name":
     // resp := Client.DropletsLs()
-    body := UseDiskCache( "DropletsLs", CacheMaxSeconds(), func () interface{} { return *Client.DropletsLs() })
     var resp diocean.ActiveDropletsResponse
-    resp.Unmarshal(body)
+    CachedLookup("DropletsLs", &resp)
     for _, info := range resp.Droplets {
       words = append(words, info.Name)
     }
+	case ":profile":
+		words = ProfileNames(Profiles)
 	case ":private_networking":
 		words = []string{"true", "false"}
 	case ":backups_enabled":
@@ -709,75 +933,129 @@ func ParameterCompletions(route *Route, param, word string) []string {
 	return words
 }
 
-func DoDropletsDestroyDroplet(route *Route) {
-	Client.DoDropletsDestroyDroplet(route.Params["droplet_id"], route.Params["scrub_data"])
+func DoDropletsDestroyDroplet(route *Route) error {
+	scrubData := route.Params["scrub_data"]
+	if scrubData == "" {
+		scrubData = "false"
+	}
+	params := url.Values{}
+	params.Set("scrub_data", scrubData)
+	return EmitApiCall("/droplets/"+route.Params["droplet_id"]+"/destroy", params, func() {
+		Client.DoDropletsDestroyDroplet(route.Params["droplet_id"], scrubData)
+	})
 }
 
-func DoDropletsLs(route *Route) {
-	Client.DoDropletsLs()
+func DoDropletsLs(route *Route) error {
+	return EmitListResponse([]string{"id", "name", "status", "ip_address", "region", "size", "image"}, ListCall("DropletsLs", &diocean.ActiveDropletsResponse{}), Client.DoDropletsLs)
 }
 
-func DoImagesLs(route *Route) {
-	Client.DoImagesLs()
+func DoImagesLs(route *Route) error {
+	return EmitListResponse([]string{"id", "name", "distribution", "slug", "public"}, ListCall("ImagesLs", &diocean.ImagesResponse{}), Client.DoImagesLs)
 }
 
-func DoImageShow(route *Route) {
-	Client.DoImageShow(route.Params["image_id"])
+func DoImageShow(route *Route) error {
+	return EmitApiCall("/images/"+route.Params["image_id"], nil, func() {
+		Client.DoImageShow(route.Params["image_id"])
+	})
 }
 
-func DoImageDestroy(route *Route) {
-	Client.DoImageDestroy(route.Params["image_id"])
+func DoImageDestroy(route *Route) error {
+	for _, imageId := range route.ParamValues("image_id") {
+		err := EmitApiCall("/images/"+imageId+"/destroy", nil, func() {
+			Client.DoImageDestroy(imageId)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func DoImageTransfer(route *Route) {
-	Client.DoImageTransfer(route.Params["image_id"], route.Params["region_id"])
-}
+func DoImageTransfer(route *Route) error {
+	imageId := route.Params["image_id"]
+	for _, region := range route.ParamValues("region") {
+		regionId := region
+		if _, err := strconv.Atoi(region); err != nil {
+			id, found, err := ResolveSlugToId("region", region)
+			if err != nil {
+				return err
+			}
+			if !found {
+				return NotFoundError("images transfer: unknown region '%s', see 'regions ls'", region)
+			}
+			regionId = id
+		}
 
-func DoEventShow(route *Route) {
-	Client.DoEventShow(route.Params["event_id"])
+		params := url.Values{}
+		params.Set("region_id", regionId)
+		err := EmitApiCall("/images/"+imageId+"/transfer", params, func() {
+			Client.DoImageTransfer(imageId, regionId)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func DoEventWait(route *Route) {
-	Client.DoEventWait(route.Params["event_id"])
+func DoEventShow(route *Route) error {
+	return EmitApiCall("/events/"+route.Params["event_id"], nil, func() {
+		Client.DoEventShow(route.Params["event_id"])
+	})
 }
 
-func DoRegionsLs(route *Route) {
-	Client.DoRegionsLs()
+func DoEventWait(route *Route) error {
+	for _, eventId := range route.ParamValues("event_id") {
+		err := EmitResponse(func() (interface{}, error) {
+			return ApiWaitForEvent(eventId)
+		}, func() {
+			Client.DoEventWait(eventId)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func DoSshKeysLs(route *Route) {
-	Client.DoSshKeysLs()
+func DoRegionsLs(route *Route) error {
+	return EmitListResponse([]string{"id", "name", "slug"}, ListCall("RegionsLs", &diocean.RegionResponse{}), Client.DoRegionsLs)
 }
 
-func FindDropletByName (self *diocean.DioceanClient, name string) *diocean.DropletInfo {
-  resp := self.DropletsLs()
-  for _, droplet := range resp.Droplets {
-    if name == droplet.Name {
-      return &droplet
-    }
-  }
-  return nil
+func DoSshKeysLs(route *Route) error {
+	return EmitListResponse([]string{"id", "name"}, ListCall("SshKeysLs", &diocean.SshKeysResponse{}), Client.DoSshKeysLs)
 }
 
-func DoSshToDroplet (route *Route) {
-  droplet := FindDropletByName(Client, route.Params["droplet_name"])
-  fmt.Printf("DoSshToDroplet: %s\n", droplet)
-  if droplet == nil { 
-		fmt.Fprintf(os.Stderr, "Droplet name not found\n")
-		os.Exit(1)
-  }
-
-	err := syscall.Exec("/usr/bin/ssh", []string{"ssh", "root@" + droplet.Ip_address}, syscall.Environ())
+func FindDropletByName(name string) (*diocean.DropletInfo, error) {
+	resp, err := ApiList("/droplets/", &diocean.ActiveDropletsResponse{})()
+	if err != nil {
+		return nil, err
+	}
+	for _, droplet := range resp.(*diocean.ActiveDropletsResponse).Droplets {
+		if name == droplet.Name {
+			return &droplet, nil
+		}
+	}
+	return nil, nil
+}
 
+func DoSshToDroplet(route *Route) error {
+	droplet, err := FindDropletByName(route.Params["droplet_name"])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error executing ssh cmd: %s\n", err)
-		os.Exit(1)
+		return err
+	}
+	if droplet == nil {
+		return NotFoundError("no droplet named '%s', see 'droplets ls'", route.Params["droplet_name"])
 	}
+	Debugf("DoSshToDroplet: %.f\n", droplet.Id)
+
+	err = syscall.Exec("/usr/bin/ssh", []string{"ssh", "root@" + droplet.Ip_address}, syscall.Environ())
+	return fmt.Errorf("executing ssh: %s", err)
 }
 
 
-func DoSshFixKnownHosts(route *Route) {
-	Client.DoSshFixKnownHosts()
+func DoSshFixKnownHosts(route *Route) error {
+	return PrintChecked(Client.DoSshFixKnownHosts)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -825,9 +1103,9 @@ func (a ByString) Less(i, j int) bool { return a[i] < a[j] }
 
 func FindCompletionWords(args []string) []string {
 	res := FindPotentialRoutes(args)
-	if CmdlineOptions.Verbose {
-		fmt.Fprintf(os.Stderr, "FindCompletionWords: args[%d]='%s' res.len=%d\n", len(args), args, len(res))
-		fmt.Fprintf(os.Stderr, "  res=%s\n", res)
+	Debugf("FindCompletionWords: args[%d]='%s' res.len=%d\n", len(args), args, len(res))
+	for _, route := range res {
+		Debugf("  Route: %s\n", strings.Join(route.Pattern, " "))
 	}
 
 	words := make([]string, 0)
@@ -844,47 +1122,96 @@ func FindCompletionWords(args []string) []string {
 	for _, route := range res {
 		words = ConcatUnique(words, route.CompletionsFor(atIdx, arg))
 	}
+	if atIdx == 0 {
+		words = ConcatUnique(words, PluginCompletions(arg))
+	}
 	sort.Sort(ByString(words))
 
 	return words
 }
 
-func FindCompletions(args []string) {
-	words := FindCompletionWords(args)
+// CompletionWords are the candidates for the last of args, a partial
+// command line that may have flags and route options in it.
+func CompletionWords(args []string) ([]string, error) {
+	words, isOption := RouteOptionCompletions(args)
+	if isOption {
+		return words, nil
+	}
+	args, err := ParseInterspersedFlags(flag.CommandLine, args)
+	if err != nil {
+		return nil, WithExitCode(ExitUsage, err)
+	}
+	return FindCompletionWords(args), nil
+}
+
+func FindCompletions(args []string) error {
+	words, err := CompletionWords(args)
+	if err != nil {
+		return err
+	}
 	if CmdlineOptions.Verbose {
 		fmt.Fprintf(os.Stderr, "FindCompletions words are: %s\n", strings.Join(words, ","))
 	}
 	fmt.Printf("%s\n", strings.Join(words, " "))
-	return
+	return nil
 }
 
 func IsPatternParam(s string) bool {
-	return strings.HasPrefix(s, ":")
+	return strings.HasPrefix(s, ":") || strings.HasPrefix(s, "[:")
 }
 
-func (self *Route) CompletionsFor(idx int, word string) []string {
+func IsOptionalParam(s string) bool {
+	return strings.HasPrefix(s, "[:") && strings.HasSuffix(s, "]")
+}
+
+func IsVariadicParam(s string) bool {
+	return IsPatternParam(s) && (strings.HasSuffix(s, "...") || strings.HasSuffix(s, "...]"))
+}
+
+// PatternParamName strips the decoration from a pattern parameter:
+// ':droplet_id', '[:droplet_id]', ':droplet_id...' and '[:droplet_id...]'
+// are all 'droplet_id'
+func PatternParamName(s string) string {
+	s = strings.TrimPrefix(s, "[")
+	s = strings.TrimSuffix(s, "]")
+	s = strings.TrimSuffix(s, "...")
+	return StripColonPrefix(s)
+}
+
+// PatternPartAt returns the pattern part that the idx'th arg would match,
+// repeating a trailing variadic parameter.  Parameters are returned in their
+// plain ':name' form.
+func (self *Route) PatternPartAt(idx int) (string, bool) {
 	if idx >= len(self.Pattern) {
-		return []string{}
+		if len(self.Pattern) == 0 || !IsVariadicParam(self.Pattern[len(self.Pattern)-1]) {
+			return "", false
+		}
+		idx = len(self.Pattern) - 1
 	}
-	part := self.Pattern[idx]
 
-	if CmdlineOptions.Verbose {
-		fmt.Fprintf(os.Stderr, "CompletionsFor[%s:%d,%s~%s]: len(self.Pattern)=%d\n", strings.Join(self.Pattern, " "), idx, part, word, len(self.Pattern))
+	part := self.Pattern[idx]
+	if IsPatternParam(part) {
+		part = ":" + PatternParamName(part)
 	}
+	return part, true
+}
 
-	if len(self.Pattern) < idx+1 {
-		if CmdlineOptions.Verbose {
-			fmt.Fprintf(os.Stderr, "CompletionsFor[%d,%s~%s]: not enough pattern, no more words\n", idx, part, word)
-		}
+func (self *Route) CompletionsFor(idx int, word string) []string {
+	part, ok := self.PatternPartAt(idx)
+	if !ok {
 		return []string{}
 	}
 
+	if CmdlineOptions.Verbose {
+		fmt.Fprintf(os.Stderr, "CompletionsFor[%s:%d,%s~%s]: len(self.Pattern)=%d\n", strings.Join(self.Pattern, " "), idx, part, word, len(self.Pattern))
+	}
+
 	if part == word {
 		if CmdlineOptions.Verbose {
 			fmt.Fprintf(os.Stderr, "CompletionsFor[%d,%s~%s]: exact hit\n", idx, part, word)
 		}
-		if len(self.Pattern) > idx+1 {
-			part = self.Pattern[idx+1]
+		if next, hasNext := self.PatternPartAt(idx + 1); hasNext {
+			part = next
 			word = ""
 			if CmdlineOptions.Verbose {
 				fmt.Fprintf(os.Stderr, "CompletionsFor[%d,%s~%s]: exact hit, use next\n", idx, part, word)
@@ -953,6 +1280,32 @@ func (self *Route) CompletionsFor(idx int, word string) []string {
 	return []string{}
 }
 
+// ParseInterspersedFlags allows options to follow the command, as in
+// 'diocean droplets ls --filter status=active'.  Anything after a '--' is
+// left as a positional argument.
+func ParseInterspersedFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for len(args) > 0 {
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+
+		consumed := len(args) - len(flags.Args())
+		if consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, flags.Args()...)
+			break
+		}
+
+		args = flags.Args()
+		if len(args) > 0 {
+			positional = append(positional, args[0])
+			args = args[1:]
+		}
+	}
+	return positional, nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 var DummyCompletion string = "DummyCompletion"
@@ -960,7 +1313,7 @@ var DummyCompletion string = "DummyCompletion"
 func main() {
 	configPath := os.Getenv("DIOCEAN_CONFIG")
 	if configPath == "" {
-		configPath = filepath.Join(os.Getenv("HOME"), ".digitalocean.json")
+		configPath = DefaultConfigPath(os.Getenv("HOME"))
 	}
 
 	flag.StringVar(&CmdlineOptions.ConfigPath,
@@ -971,53 +1324,162 @@ func main() {
 	flag.BoolVar(&CmdlineOptions.CompletionCandidate, "cmplt", false, "Completion")
 	flag.BoolVar(&CmdlineOptions.Verbose,       "v", false, "Verbose")
 	flag.BoolVar(&CmdlineOptions.WaitForEvents, "w", false, "For commands that return an event_id, wait for the event to complete.")
+	flag.DurationVar(&EventWaitTimeout, "wait.timeout", 0, "With -w, give up waiting on an event after this long, eg: 10m (default: no limit)")
 	flag.BoolVar(&CmdlineOptions.UseDiskCache,   "cache.on", true, "Use an on-disk cache to speed up common API responses.")
 	flag.Var(&CmdlineOptions.CacheMaxSeconds, "cache.age",  "Maximum time in seconds to cache responses.")
   flag.Var(&CmdlineOptions.CachePath,    "cache.path", "Directory to use for disk cache (default=~/.digitalocean/cache)")
+	flag.StringVar(&CmdlineOptions.Profile, "profile", "", "Use a named profile from the configuration file (default: $DIOCEAN_PROFILE, then the one set with 'diocean profile use')")
+	flag.BoolVar(&CmdlineOptions.DryRun, "dry-run", false, "Show the command's resolved parameters, and where each came from, without calling the API.")
+	flag.BoolVar(&CmdlineOptions.Quiet, "q", false, "Quiet, only print ids: of listed or created records, or of the event started by an action.")
+	flag.Var(&CmdlineOptions.Filters, "filter", "Only list records matching field=value, field!=value, field~regex or field!~regex, may be repeated.")
+	flag.StringVar(&CmdlineOptions.Sort, "sort", "", "Sort listed records by a field, eg: name, created, size.")
+	flag.StringVar(&CmdlineOptions.Output, "o", "", "Output format: text, table[=<field,..>], json, yaml, csv[=<field,..>], template=<go template> or columns=<field,field,..> (default: table on a terminal, otherwise text)")
 
 	InitRoutingTable()
+	RegisterRouteOptions(flag.CommandLine)
 	flag.Parse()
-	route := FindMatchingRoute(flag.Args())
+	LoadAliases(CmdlineOptions.ConfigPath)
+	for _, problem := range CheckRoutingTable(RoutingTable) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", problem)
+	}
 
-	if CmdlineOptions.Verbose {
-		fmt.Fprintf(os.Stderr, "Args: %s\n", flag.Args())
+	// a partial command line is being completed, options are left in place
+	// for FindCompletions to make sense of
+	args := flag.Args()
+	var err error
+	if !CmdlineOptions.CompletionCandidate {
+		args, err = ParseCommandLine(flag.CommandLine, args)
+		if err != nil {
+			os.Exit(ExitUsage)
+		}
 	}
 
-	if !InitConfig() {
-		fmt.Fprintf(os.Stderr, "Invalid or Missing configuration file.\n")
-		os.Exit(1)
+	// eg: ^C while waiting on an event
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range interrupted {
+			Interrupt()
+		}
+	}()
+
+	if err := Run(args); err != nil {
+		Fail(err)
 	}
-	if CmdlineOptions.Verbose {
-		fmt.Fprintf(os.Stderr, "Config: %s\n", Config)
+}
+
+// Run runs the command line left after the global flags, the error says how
+// it failed, see ExitCode.
+func Run(args []string) error {
+	route := FindMatchingRoute(args)
+
+	Debugf("Args: %s\n", args)
+
+	// a mistyped command is a usage error whatever the state of the config
+	if route == nil && !CmdlineOptions.CompletionCandidate && !OwnsConfig(route, args) {
+		return UnknownCommandError(args)
 	}
 
-	Client = &diocean.DioceanClient{
-		ClientId:      Config["ClientId"],
-		ApiKey:        Config["ApiKey"],
-		Verbose:       CmdlineOptions.Verbose,
-		WaitForEvents: CmdlineOptions.WaitForEvents,
+	if OwnsConfig(route, args) {
+		LoadConfig()
+	} else if err := LoadConfig(); err != nil {
+		return WithExitCode(ExitConfig, err)
 	}
+	Debugf("Config: %s\n", RedactConfig(Config))
+	NewClient()
 
 	if CmdlineOptions.CompletionCandidate {
 		// this is a hack
-		if len(flag.Args()) > 0 && (flag.Args()[0] == "diocean" || flag.Args()[0] == "diocean") {
-			FindCompletions(flag.Args()[1:])
-		} else {
-			FindCompletions(flag.Args())
+		if len(args) > 0 && args[0] == "diocean" {
+			return FindCompletions(args[1:])
 		}
-		os.Exit(0)
+		return FindCompletions(args)
 	}
 
-	if route == nil {
-		fmt.Fprintf(os.Stderr, "Error: unrecognized command: %s\n", flag.Args())
-		ShowGeneralHelp(route)
-		os.Exit(1)
+	return RunRoute(route, args)
+}
+
+// UnknownCommandError is the usage error for args that match no route,
+// naming the commands they might have meant, or else with the list of
+// commands printed.
+func UnknownCommandError(args []string) error {
+	if err := TrailingArgsError(args); err != nil {
+		return WithExitCode(ExitUsage, err)
+	}
+	if err := MissingParamError(args); err != nil {
+		return WithExitCode(ExitUsage, err)
+	}
+	err := UsageError("unrecognized command: %s", strings.Join(args, " "))
+	if suggestions := SuggestCommands(args); len(suggestions) > 0 {
+		return &ExitError{Code: ExitUsage, Err: err, Hint: fmt.Sprintf("Did you mean: diocean %s?\nSee 'diocean help' for the list of commands.", strings.Join(suggestions, ", diocean "))}
 	}
+	ShowGeneralHelp(nil)
+	return err
+}
 
+// OwnsConfig is true for the commands that cope with a missing or broken
+// config themselves: routes that don't call the API, eg: 'config init', and
+// plugins.
+func OwnsConfig(route *Route, args []string) bool {
 	if route != nil {
-		if CmdlineOptions.Verbose {
-			fmt.Fprintf(os.Stderr, "Calling route: %s\n", route)
+		return route.Offline
+	}
+	return len(args) > 0 && FindPlugin(args[0]) != nil
+}
+
+// NewClient sets up the client library with the loaded config.  The
+// library's own verbose output prints urls with the api_key in them, so it
+// is left off, -v shows its calls through ApiTransport instead.
+func NewClient() {
+	Client = &diocean.DioceanClient{
+		ClientId:      Config.ClientId,
+		ApiKey:        Config.ApiKey,
+		WaitForEvents: CmdlineOptions.WaitForEvents,
+	}
+	UseApiTransport()
+}
+
+// RunRoute runs a command, once the config is loaded, with the route
+// FindMatchingRoute found for args, nil when there was none.
+func RunRoute(route *Route, args []string) error {
+	if CmdlineOptions.Output == "" {
+		CmdlineOptions.Output = DefaultOutputFormat()
+	}
+
+	var err error
+	CmdlineOptions.OutputFormat, CmdlineOptions.OutputArg, err = ParseOutputFormat(CmdlineOptions.Output)
+	if err != nil {
+		return WithExitCode(ExitUsage, err)
+	}
+
+	if route == nil {
+		if len(args) > 0 {
+			if plugin := FindPlugin(args[0]); plugin != nil {
+				return plugin.Run(args[1:])
+			}
 		}
-		route.Handler(route)
+		return UnknownCommandError(args)
+	}
+
+	if err := route.ResolveOptions(CmdlineOptions.RouteOptions); err != nil {
+		return WithExitCode(ExitUsage, err)
+	}
+
+	if err := route.ValidateParams(); err != nil {
+		return WithExitCode(ExitUsage, err)
+	}
+
+	// an alias's commands show what they would do themselves
+	if CmdlineOptions.DryRun && route.Alias == nil {
+		fmt.Print(route.ResolvedParams())
+		return nil
+	}
+
+	Debugf("Calling route: %s\n%s", strings.Join(route.Pattern, " "), route.ResolvedParams())
+	err = route.Handler(route)
+	// even a failure may have changed some of them, eg: one of several images
+	for _, name := range route.StaleLists {
+		RemoveFromDiskCache(name)
 	}
+	return err
 }
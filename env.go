@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Environment variables override the config file, eg: for CI where the
+// credentials come from secrets rather than a file.  The -c, -cache.path and
+// -cache.age flags still take precedence.
+
+type EnvOverride struct {
+	Env string
+	Key string
+}
+
+var EnvOverrides = []EnvOverride{
+	{"DIOCEAN_CLIENT_ID", "ClientId"},
+	{"DIOCEAN_API_KEY", "ApiKey"},
+	{"DIOCEAN_TOKEN", "Token"},
+	{"DIOCEAN_CACHE_DIRECTORY", "CacheDirectory"},
+	{"DIOCEAN_CACHE_MAX_SECONDS", "CacheMaxSeconds"},
+}
+
+// EnvHasCredentials is true when the environment alone is enough to call the
+// API, in which case the config file may be missing.
+func EnvHasCredentials() bool {
+	return os.Getenv("DIOCEAN_CLIENT_ID") != "" && os.Getenv("DIOCEAN_API_KEY") != ""
+}
+
+// ApplyEnvOverrides returns the settings with the environment variables
+// that are set layered on top.  DIOCEAN_CACHE_DIRECTORY is the base
+// directory when a profile is in use, the same as a top level
+// CacheDirectory, so profiles still get separate caches.
+func ApplyEnvOverrides(config Settings, profile string) (Settings, error) {
+	res := config
+	for _, override := range EnvOverrides {
+		value := os.Getenv(override.Env)
+		if value == "" {
+			continue
+		}
+
+		if override.Key == "CacheDirectory" && profile != "" {
+			value = filepath.Join(value, profile)
+		}
+		if err := res.Set(override.Key, value); err != nil {
+			return Settings{}, fmt.Errorf("$%s: %s", override.Env, err)
+		}
+	}
+
+	return res, nil
+}
+
+// EnvVarFor is the environment variable that overrides a setting.
+func EnvVarFor(key string) string {
+	for _, override := range EnvOverrides {
+		if override.Key == key {
+			return override.Env
+		}
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withEnv(t *testing.T, env map[string]string, fn func()) {
+	saved := make(map[string]string)
+	for _, override := range EnvOverrides {
+		saved[override.Env] = os.Getenv(override.Env)
+		os.Setenv(override.Env, env[override.Env])
+	}
+	defer func() {
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	}()
+	fn()
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	config := MockSettings(t, map[string]string{"ClientId": "client-0", "ApiKey": "key-0", "CacheMaxSeconds": "600"})
+
+	withEnv(t, map[string]string{
+		"DIOCEAN_API_KEY":           "key-env",
+		"DIOCEAN_TOKEN":             "token-env",
+		"DIOCEAN_CACHE_DIRECTORY":   "/tmp/diocean-cache",
+		"DIOCEAN_CACHE_MAX_SECONDS": "60",
+	}, func() {
+		if EnvHasCredentials() {
+			t.Errorf("EnvHasCredentials() without DIOCEAN_CLIENT_ID should be false")
+		}
+
+		res, err := ApplyEnvOverrides(config, "")
+		if err != nil {
+			t.Fatalf("ApplyEnvOverrides => %s", err)
+		}
+		expected := map[string]string{
+			"ClientId":        "client-0",
+			"ApiKey":          "key-env",
+			"Token":           "token-env",
+			"CacheDirectory":  "/tmp/diocean-cache",
+			"CacheMaxSeconds": "60",
+		}
+		for key, value := range expected {
+			if res.Get(key) != value {
+				t.Errorf("ApplyEnvOverrides: %s => '%s' expected '%s'", key, res.Get(key), value)
+			}
+		}
+		if config.Get("ApiKey") != "key-0" {
+			t.Errorf("ApplyEnvOverrides modified its argument: %v", config)
+		}
+
+		res, _ = ApplyEnvOverrides(config, "staging")
+		if res.Get("CacheDirectory") != filepath.Join("/tmp/diocean-cache", "staging") {
+			t.Errorf("ApplyEnvOverrides(staging) => CacheDirectory %s", res.Get("CacheDirectory"))
+		}
+	})
+
+	withEnv(t, map[string]string{"DIOCEAN_CACHE_MAX_SECONDS": "ten"}, func() {
+		_, err := ApplyEnvOverrides(config, "")
+		if err == nil || !strings.Contains(err.Error(), "DIOCEAN_CACHE_MAX_SECONDS") {
+			t.Errorf("ApplyEnvOverrides with an invalid DIOCEAN_CACHE_MAX_SECONDS => %v", err)
+		}
+	})
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	home, err := ioutil.TempDir("", "diocean-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	// no saved profile, nor one from the environment
+	savedPath, savedConfig, savedHome, savedProfile := CmdlineOptions.ConfigPath, Config, os.Getenv("HOME"), os.Getenv("DIOCEAN_PROFILE")
+	defer func() {
+		CmdlineOptions.ConfigPath, Config = savedPath, savedConfig
+		os.Setenv("HOME", savedHome)
+		os.Setenv("DIOCEAN_PROFILE", savedProfile)
+	}()
+	os.Setenv("HOME", home)
+	os.Setenv("DIOCEAN_PROFILE", "")
+	CmdlineOptions.ConfigPath = filepath.Join(home, ".digitalocean.json")
+
+	withEnv(t, map[string]string{
+		"DIOCEAN_CLIENT_ID": "client-env",
+		"DIOCEAN_API_KEY":   "key-env",
+	}, func() {
+		if err := LoadConfig(); err != nil {
+			t.Fatalf("LoadConfig() without a config file should use the environment: %s", err)
+		}
+		if Config.Get("ClientId") != "client-env" || Config.Get("ApiKey") != "key-env" {
+			t.Errorf("LoadConfig() => %v", Config)
+		}
+	})
+}
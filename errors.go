@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// Exit codes, documented in the README for scripts to branch on.  Errors
+// carry their class as an *ExitError, anything else exits with ExitFailure.
+const (
+	ExitOk        = 0
+	ExitFailure   = 1   // anything not covered below, eg: an unwritable cache
+	ExitUsage     = 2   // unknown command, bad flags or parameters
+	ExitConfig    = 3   // missing or broken config file or credentials
+	ExitAuth      = 4   // the API rejected the credentials
+	ExitNotFound  = 5   // the droplet, image, region, ... does not exist
+	ExitApi       = 6   // the API failed or could not be reached
+	ExitTimeout   = 7   // an API call, event wait or secret command took too long
+	ExitCancelled = 130 // interrupted, or a confirmation was declined
+)
+
+type ExitError struct {
+	Code int
+	Err  error
+	// printed after the error, eg: suggestions for a mistyped command
+	Hint string
+}
+
+func (self *ExitError) Error() string {
+	return self.Err.Error()
+}
+
+func (self *ExitError) Unwrap() error {
+	return self.Err
+}
+
+// WithExitCode classifies err, unless it already has a class.
+func WithExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+	return &ExitError{Code: code, Err: err}
+}
+
+func UsageError(format string, args ...interface{}) error {
+	return &ExitError{Code: ExitUsage, Err: fmt.Errorf(format, args...)}
+}
+
+func NotFoundError(format string, args ...interface{}) error {
+	return &ExitError{Code: ExitNotFound, Err: fmt.Errorf(format, args...)}
+}
+
+func CancelledError(format string, args ...interface{}) error {
+	return &ExitError{Code: ExitCancelled, Err: fmt.Errorf(format, args...)}
+}
+
+// ExitCode is the exit status for err, see the constants above.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOk
+	}
+
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ExitTimeout
+	case errors.Is(err, context.Canceled):
+		return ExitCancelled
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ExitTimeout
+	}
+	return ExitFailure
+}
+
+// ReportError prints err, and its hint if it has one.
+func ReportError(w io.Writer, err error) {
+	fmt.Fprintf(w, "Error: %s\n", err)
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) && exitErr.Hint != "" {
+		fmt.Fprintf(w, "%s\n", exitErr.Hint)
+	}
+}
+
+// Fail reports err and exits with its exit code.
+func Fail(err error) {
+	ReportError(os.Stderr, err)
+	os.Exit(ExitCode(err))
+}
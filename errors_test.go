@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kyleburton/diocean-go"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		Err      error
+		Expected int
+	}{
+		{nil, ExitOk},
+		{fmt.Errorf("disk full"), ExitFailure},
+		{UsageError("unrecognized command: %s", "droplets frob"), ExitUsage},
+		{NotFoundError("no droplet named '%s'", "web1"), ExitNotFound},
+		{CancelledError("interrupted"), ExitCancelled},
+		{WithExitCode(ExitConfig, UsageError("first class wins")), ExitUsage},
+		{fmt.Errorf("wrapped: %w", &ExitError{Code: ExitAuth, Err: fmt.Errorf("denied")}), ExitAuth},
+		{context.DeadlineExceeded, ExitTimeout},
+		{context.Canceled, ExitCancelled},
+	}
+
+	for _, tc := range cases {
+		if code := ExitCode(tc.Err); code != tc.Expected {
+			t.Errorf("ExitCode(%v) => %d, expected %d", tc.Err, code, tc.Expected)
+		}
+	}
+}
+
+func TestApiCallExitCodes(t *testing.T) {
+	cases := []struct {
+		Status   int
+		Body     string
+		Expected int
+	}{
+		{200, `{"status": "ERROR", "error_message": "Access Denied"}`, ExitAuth},
+		{401, `{"status": "ERROR", "error_message": "Unauthorized"}`, ExitAuth},
+		{200, `{"status": "ERROR", "error_message": "No Droplets Found"}`, ExitNotFound},
+		{404, `{"status": "ERROR", "error_message": "Not Found"}`, ExitNotFound},
+		{500, `{"status": "ERROR", "error_message": "Internal Server Error"}`, ExitApi},
+		{502, `<html>Bad Gateway</html>`, ExitApi},
+	}
+
+	savedClient, savedUrl := Client, ApiBaseUrl
+	defer func() { Client, ApiBaseUrl = savedClient, savedUrl }()
+	Client = &diocean.DioceanClient{ClientId: "client-1", ApiKey: "key-1"}
+
+	for _, tc := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.Status)
+			w.Write([]byte(tc.Body))
+		}))
+		ApiBaseUrl = server.URL
+		_, err := ApiCall("/droplets/123", nil)
+		if code := ExitCode(err); code != tc.Expected {
+			t.Errorf("ApiCall => HTTP %d %s => %v, exit code %d, expected %d", tc.Status, tc.Body, err, code, tc.Expected)
+		}
+		server.Close()
+	}
+
+	// a server that doesn't answer in time
+	savedHttpClient := ApiHttpClient
+	defer func() { ApiHttpClient = savedHttpClient }()
+	ApiHttpClient = &http.Client{Timeout: 50 * time.Millisecond}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	ApiBaseUrl = server.URL
+	if _, err := ApiCall("/regions", nil); ExitCode(err) != ExitTimeout {
+		t.Errorf("ApiCall to a slow server => %v, exit code %d", err, ExitCode(err))
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"github.com/kyleburton/diocean-go"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client side filtering and sorting of list responses, see --filter and
+// --sort.
+
+type StringListFlag []string
+
+func (self *StringListFlag) String() string {
+	return strings.Join(*self, ",")
+}
+
+func (self *StringListFlag) Set(s string) error {
+	*self = append(*self, s)
+	return nil
+}
+
+const (
+	FilterEquals     = "="
+	FilterNotEquals  = "!="
+	FilterMatches    = "~"
+	FilterNotMatches = "!~"
+)
+
+type RowFilter struct {
+	Field string
+	Op    string
+	Value string
+	Regex *regexp.Regexp
+}
+
+// ParseRowFilter parses a --filter expression: field=value, field!=value,
+// field~regex or field!~regex
+func ParseRowFilter(expr string) (*RowFilter, error) {
+	idx := strings.IndexAny(expr, "=~")
+	if idx < 1 {
+		return nil, fmt.Errorf("invalid filter '%s', expected field=value, field!=value, field~regex or field!~regex", expr)
+	}
+
+	filter := &RowFilter{Field: expr[:idx], Op: expr[idx : idx+1], Value: expr[idx+1:]}
+	if strings.HasSuffix(filter.Field, "!") {
+		filter.Field = filter.Field[:len(filter.Field)-1]
+		filter.Op = "!" + filter.Op
+	}
+
+	if filter.Op == FilterMatches || filter.Op == FilterNotMatches {
+		re, err := regexp.Compile(filter.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter '%s': %s", expr, err)
+		}
+		filter.Regex = re
+	}
+
+	return filter, nil
+}
+
+// ResolveSlugToId maps a region, size or image slug to its numeric id so that
+// eg: region=nyc2 can be compared against a droplet's Region_id.
+func ResolveSlugToId(kind, slug string) (string, bool, error) {
+	switch kind {
+	case "region":
+		var resp diocean.RegionResponse
+		if err := LookupList("RegionsLs", &resp); err != nil {
+			return "", false, err
+		}
+		for _, info := range resp.Regions {
+			if info.Slug == slug {
+				return fmt.Sprintf("%.f", info.Id), true, nil
+			}
+		}
+	case "size":
+		var resp diocean.DropletSizesResponse
+		if err := LookupList("DropletSizes", &resp); err != nil {
+			return "", false, err
+		}
+		for _, info := range resp.Sizes {
+			if info.Slug == slug {
+				return fmt.Sprintf("%.f", info.Id), true, nil
+			}
+		}
+	case "image":
+		var resp diocean.ImagesResponse
+		if err := LookupList("ImagesLs", &resp); err != nil {
+			return "", false, err
+		}
+		for _, info := range resp.Images {
+			if info.Slug == slug {
+				return fmt.Sprintf("%.f", info.Id), true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// Resolve checks the filter's field against the record type, translating
+// slugs to ids for the region, size and image fields.
+func (self *RowFilter) Resolve(rowType reflect.Type) (int, error) {
+	idx, found := RowFieldIndex(rowType, self.Field)
+	if !found {
+		return -1, UnknownFieldError(rowType, self.Field)
+	}
+
+	fieldName := strings.ToLower(rowType.Field(idx).Name)
+	if self.Regex == nil && strings.HasSuffix(fieldName, "_id") {
+		if _, err := strconv.ParseFloat(self.Value, 64); err != nil {
+			id, found, err := ResolveSlugToId(strings.TrimSuffix(fieldName, "_id"), self.Value)
+			if err != nil {
+				return -1, err
+			}
+			if !found {
+				return -1, fmt.Errorf("unknown %s '%s' in filter", self.Field, self.Value)
+			}
+			self.Value = id
+		}
+	}
+
+	return idx, nil
+}
+
+func (self *RowFilter) Matches(value string) bool {
+	switch self.Op {
+	case FilterEquals:
+		return value == self.Value
+	case FilterNotEquals:
+		return value != self.Value
+	case FilterMatches:
+		return self.Regex.MatchString(value)
+	case FilterNotMatches:
+		return !self.Regex.MatchString(value)
+	}
+	return false
+}
+
+// FilterAndSortResponse returns a copy of a list response holding only the
+// records that pass every filter, ordered by sortKey when it is not empty.
+func FilterAndSortResponse(resp interface{}, exprs []string, sortKey string) (interface{}, error) {
+	val := reflect.ValueOf(resp)
+	isPtr := val.Kind() == reflect.Ptr
+	val = reflect.Indirect(val)
+
+	rows, rowType, isList := ResponseRows(resp)
+	if !isList {
+		return nil, fmt.Errorf("--filter and --sort are only supported for list commands")
+	}
+
+	filters := make([]*RowFilter, len(exprs))
+	indexes := make([]int, len(exprs))
+	for ii, expr := range exprs {
+		filter, err := ParseRowFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		indexes[ii], err = filter.Resolve(rowType)
+		if err != nil {
+			return nil, err
+		}
+		filters[ii] = filter
+	}
+
+	kept := make([]reflect.Value, 0, len(rows))
+	for _, row := range rows {
+		matched := true
+		for ii, filter := range filters {
+			if !filter.Matches(FormatFieldValue(row.Field(indexes[ii]))) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			kept = append(kept, row)
+		}
+	}
+
+	if sortKey != "" {
+		idx, found := RowFieldIndex(rowType, sortKey)
+		if !found {
+			return nil, UnknownFieldError(rowType, sortKey)
+		}
+		sortKey, err := SortKeyFn(rowType, idx)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(kept, func(i, j int) bool {
+			return FieldLess(sortKey(kept[i]), sortKey(kept[j]))
+		})
+	}
+
+	// copy the response and swap in the remaining records
+	res := reflect.New(val.Type())
+	res.Elem().Set(val)
+	for ii := 0; ii < val.NumField(); ii++ {
+		field := res.Elem().Field(ii)
+		sliceType := field.Type()
+		if sliceType.Kind() == reflect.Ptr {
+			sliceType = sliceType.Elem()
+		}
+		if sliceType.Kind() != reflect.Slice {
+			continue
+		}
+
+		slice := reflect.MakeSlice(sliceType, 0, len(kept))
+		for _, row := range kept {
+			slice = reflect.Append(slice, row)
+		}
+		if field.Kind() == reflect.Ptr {
+			ptr := reflect.New(sliceType)
+			ptr.Elem().Set(slice)
+			field.Set(ptr)
+		} else {
+			field.Set(slice)
+		}
+		break
+	}
+
+	if isPtr {
+		return res.Interface(), nil
+	}
+	return res.Elem().Interface(), nil
+}
+
+// SortKeyFn returns what --sort orders records by: the field itself, except
+// that sizes go by their place in the sizes list, smallest first, rather
+// than by id, and the _at fields by time.
+func SortKeyFn(rowType reflect.Type, idx int) (func(row reflect.Value) reflect.Value, error) {
+	fieldName := strings.ToLower(rowType.Field(idx).Name)
+	switch {
+	case fieldName == "size_id":
+		order, err := SizeOrder()
+		if err != nil {
+			return nil, err
+		}
+		return func(row reflect.Value) reflect.Value {
+			pos, found := order[FormatFieldValue(row.Field(idx))]
+			if !found {
+				pos = len(order)
+			}
+			return reflect.ValueOf(pos)
+		}, nil
+	case strings.HasSuffix(fieldName, "_at"):
+		return func(row reflect.Value) reflect.Value {
+			// an unparsable time sorts first, as the zero time
+			at, _ := time.Parse(time.RFC3339, FormatFieldValue(row.Field(idx)))
+			return reflect.ValueOf(at)
+		}, nil
+	}
+	return func(row reflect.Value) reflect.Value {
+		return row.Field(idx)
+	}, nil
+}
+
+// SizeOrder maps each size id to its place in the sizes list, which runs
+// from the smallest size to the largest.
+func SizeOrder() (map[string]int, error) {
+	var resp diocean.DropletSizesResponse
+	if err := LookupList("DropletSizes", &resp); err != nil {
+		return nil, err
+	}
+	order := make(map[string]int)
+	for ii, info := range resp.Sizes {
+		order[fmt.Sprintf("%.f", info.Id)] = ii
+	}
+	return order, nil
+}
+
+func FieldLess(left, right reflect.Value) bool {
+	if at, ok := left.Interface().(time.Time); ok {
+		return at.Before(right.Interface().(time.Time))
+	}
+	switch left.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return left.Float() < right.Float()
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return left.Int() < right.Int()
+	case reflect.Bool:
+		return !left.Bool() && right.Bool()
+	}
+	return FormatFieldValue(left) < FormatFieldValue(right)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"github.com/kyleburton/diocean-go"
+	"testing"
+)
+
+func RegionSlugs(resp interface{}) []string {
+	slugs := make([]string, 0)
+	for _, region := range resp.(diocean.RegionResponse).Regions {
+		slugs = append(slugs, region.Slug)
+	}
+	return slugs
+}
+
+func TestParseRowFilter(t *testing.T) {
+	filter, err := ParseRowFilter("name!~^web-")
+	if err != nil || filter.Field != "name" || filter.Op != FilterNotMatches || filter.Value != "^web-" {
+		t.Errorf("ParseRowFilter(name!~^web-) => %v, %v", filter, err)
+	}
+
+	filter, err = ParseRowFilter("status=active")
+	if err != nil || filter.Field != "status" || filter.Op != FilterEquals || filter.Value != "active" {
+		t.Errorf("ParseRowFilter(status=active) => %v, %v", filter, err)
+	}
+
+	_, err = ParseRowFilter("status")
+	if err == nil {
+		t.Errorf("ParseRowFilter(status) expected an error")
+	}
+
+	_, err = ParseRowFilter("name~[")
+	if err == nil {
+		t.Errorf("ParseRowFilter(name~[) expected an error")
+	}
+}
+
+func TestFilterAndSortResponse(t *testing.T) {
+	resp, err := FilterAndSortResponse(MockRegionsResponse(), SArray("slug~^s"), "name")
+	if err != nil {
+		t.Fatalf("FilterAndSortResponse: %s", err)
+	}
+	if slugs := RegionSlugs(resp); !StringArraysMatch(SArray("sfo1", "sgp1"), slugs) {
+		t.Errorf("FilterAndSortResponse(slug~^s, name) => %s", slugs)
+	}
+
+	resp, err = FilterAndSortResponse(MockRegionsResponse(), SArray("id!=3"), "slug")
+	if err != nil {
+		t.Fatalf("FilterAndSortResponse: %s", err)
+	}
+	if slugs := RegionSlugs(resp); !StringArraysMatch(SArray("ams2", "nyc2", "sgp1"), slugs) {
+		t.Errorf("FilterAndSortResponse(id!=3, slug) => %s", slugs)
+	}
+
+	_, err = FilterAndSortResponse(MockRegionsResponse(), SArray("bogus=1"), "")
+	if err == nil {
+		t.Errorf("FilterAndSortResponse(bogus=1) expected an error")
+	}
+}
+
+func TestSortBySizeAndTime(t *testing.T) {
+	CreateMockCachedResponse(t, "DropletSizes")
+	defer RemoveFromDiskCache("DropletSizes")
+
+	var droplets diocean.ActiveDropletsResponse
+	droplets.Unmarshal([]byte(`{"Status":"OK","Droplets":[
+{"Id":1,"Name":"a","Size_id":62,"Created_at":"2014-01-02T09:00:00Z"},
+{"Id":2,"Name":"b","Size_id":66,"Created_at":"2014-01-02T10:00:00+02:00"},
+{"Id":3,"Name":"c","Size_id":63,"Created_at":"2013-12-31T23:00:00Z"}]}`))
+
+	cases := []struct {
+		Sort     string
+		Expected []string
+	}{
+		// 512mb, 1gb, 2gb rather than ids 62, 63, 66
+		{"size", SArray("b", "c", "a")},
+		{"created", SArray("c", "b", "a")},
+		{"name", SArray("a", "b", "c")},
+	}
+
+	for _, tc := range cases {
+		resp, err := FilterAndSortResponse(droplets, nil, tc.Sort)
+		if err != nil {
+			t.Fatalf("FilterAndSortResponse(--sort %s): %s", tc.Sort, err)
+		}
+		names := make([]string, 0)
+		for _, droplet := range resp.(diocean.ActiveDropletsResponse).Droplets {
+			names = append(names, droplet.Name)
+		}
+		if !StringArraysMatch(tc.Expected, names) {
+			t.Errorf("FilterAndSortResponse(--sort %s) => %s, expected %s", tc.Sort, names, tc.Expected)
+		}
+	}
+}
+
+func TestSlugLookupErrors(t *testing.T) {
+	RemoveFromDiskCache("RegionsLs")
+	withApi(t, `{"status": "ERROR", "error_message": "Access Denied"}`, func() {
+		var droplets diocean.ActiveDropletsResponse
+		_, err := FilterAndSortResponse(droplets, SArray("region=nyc2"), "")
+		if ExitCode(err) != ExitAuth {
+			t.Errorf("FilterAndSortResponse(region=nyc2) with a failing API => %v, exit code %d", err, ExitCode(err))
+		}
+	})
+}
+
+func TestParseInterspersedFlags(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	var filters StringListFlag
+	quiet := flags.Bool("q", false, "")
+	flags.Var(&filters, "filter", "")
+
+	args, err := ParseInterspersedFlags(flags, SArray("droplets", "ls", "--filter", "name~^web-", "-q", "--", "-x"))
+	if err != nil {
+		t.Fatalf("ParseInterspersedFlags: %s", err)
+	}
+
+	if !StringArraysMatch(SArray("droplets", "ls", "-x"), args) {
+		t.Errorf("ParseInterspersedFlags args => %s", args)
+	}
+
+	if !*quiet || !StringArraysMatch(SArray("name~^web-"), filters) {
+		t.Errorf("ParseInterspersedFlags flags => q=%t filter=%s", *quiet, filters)
+	}
+}
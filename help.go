@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var ApiDocsUrl string = "https://developers.digitalocean.com"
+
+// At most this many allowed values are listed for a parameter by 'help'.
+var HelpMaxValues = 20
+
+func ShowGeneralHelp(route *Route) error {
+	if route != nil && len(route.VarParams["command"]) > 0 {
+		return ShowCommandHelp(route.VarParams["command"])
+	}
+
+	fmt.Printf("diocean <command> [arg1 [arg2 ..]] \n")
+	fmt.Printf("  Commands:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, route := range RoutingTable {
+		fmt.Fprintf(w, "    %s\t%s\n", strings.Join(route.Pattern, " "), route.Summary())
+	}
+	w.Flush()
+
+	if plugins := FindPlugins(); len(plugins) > 0 {
+		fmt.Printf("\n  Plugins:\n")
+		for _, plugin := range plugins {
+			fmt.Fprintf(w, "    %s\t%s\n", plugin.Name, plugin.Path)
+		}
+		w.Flush()
+	}
+	fmt.Printf("\n  See 'diocean help <command>' for the details of a command.\n")
+	return nil
+}
+
+// Summary is the first line of the route's help text.
+func (self *Route) Summary() string {
+	return strings.SplitN(self.HelpText, "\n", 2)[0]
+}
+
+// RoutesWithPrefix finds the routes whose command words start with words,
+// eg: 'droplets' finds every droplets command.
+func RoutesWithPrefix(words []string) []*Route {
+	routes := make([]*Route, 0)
+	for _, route := range RoutingTable {
+		cmd := route.CommandWords()
+		if len(cmd) < len(words) {
+			continue
+		}
+		if StringArraysEqual(cmd[:len(words)], words) {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+func StringArraysEqual(left, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for ii := range left {
+		if left[ii] != right[ii] {
+			return false
+		}
+	}
+	return true
+}
+
+func ShowCommandHelp(words []string) error {
+	routes := RoutesWithPrefix(words)
+	// a plugin gives its own help
+	if plugin := FindPlugin(words[0]); len(routes) == 0 && plugin != nil {
+		return plugin.Run(append(words[1:], "--help"))
+	}
+	if len(routes) == 0 {
+		return UsageError("unrecognized command: %s", strings.Join(words, " "))
+	}
+
+	exact := make([]*Route, 0)
+	for _, route := range routes {
+		if len(route.CommandWords()) == len(words) {
+			exact = append(exact, route)
+		}
+	}
+
+	// 'help droplets' lists the droplets commands
+	if len(exact) == 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, route := range routes {
+			fmt.Fprintf(w, "  %s\t%s\n", strings.Join(route.Pattern, " "), route.Summary())
+		}
+		w.Flush()
+		return nil
+	}
+
+	for ii, route := range exact {
+		if ii > 0 {
+			fmt.Printf("\n")
+		}
+		fmt.Print(route.Usage())
+	}
+	return nil
+}
+
+// Usage is the full help for a route: its parameters with their allowed
+// values, examples and a link to the API documentation.
+func (self *Route) Usage() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "Usage: diocean %s\n", strings.Join(self.Pattern, " "))
+	if self.HelpText != "" {
+		fmt.Fprintf(&buf, "\n  %s\n", strings.Replace(self.HelpText, "\n", "\n  ", -1))
+	}
+
+	if len(self.Specs) > 0 {
+		fmt.Fprintf(&buf, "\nParameters:\n")
+		w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+		for _, spec := range self.Specs {
+			fmt.Fprintf(w, "  %s\t%s (%s)\n", spec.PatternPart(), spec.Description, spec.Type)
+			values := self.AllowedValues(spec)
+			if len(values) > HelpMaxValues {
+				values = append(values[:HelpMaxValues], fmt.Sprintf("... (%d more)", len(values)-HelpMaxValues))
+			}
+			if len(values) > 0 {
+				fmt.Fprintf(w, "  \tvalues: %s\n", strings.Join(values, ", "))
+			}
+		}
+		w.Flush()
+	}
+
+	if len(self.Examples) > 0 {
+		fmt.Fprintf(&buf, "\nExamples:\n")
+		for _, example := range self.Examples {
+			fmt.Fprintf(&buf, "  %s\n", example)
+		}
+	}
+
+	if self.DocsUrl != "" {
+		fmt.Fprintf(&buf, "\nAPI documentation: %s\n", self.DocsUrl)
+	}
+
+	return buf.String()
+}
+
+// AllowedValues lists the values a parameter accepts, from the same sources
+// used for command line completion.
+func (self *Route) AllowedValues(spec *ParamSpec) []string {
+	if spec.Type == ParamBool {
+		return []string{"true", "false"}
+	}
+
+	if self.CompletionsFn == nil || spec.Type == ParamString {
+		return []string{}
+	}
+
+	values := make([]string, 0)
+	for _, value := range self.CompletionsFn(self, ":"+spec.Name, "") {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRouteUsage(t *testing.T) {
+	InitRoutingTable()
+	CreateMockCachedResponse(t, "DropletsLs")
+	defer RemoveFromDiskCache("DropletsLs")
+
+	routes := RoutesWithPrefix(SArray("droplets", "snapshot"))
+	if len(routes) != 1 {
+		t.Fatalf("RoutesWithPrefix(droplets snapshot) => %d routes", len(routes))
+	}
+
+	usage := routes[0].Usage()
+	t.Logf("Usage(droplets snapshot) => %s", usage)
+	for _, expected := range SArray(
+		"Usage: diocean droplets snapshot :droplet_id [:name]",
+		"values: 123, 456",
+		"Name for the snapshot image",
+		"Examples:",
+		"API documentation: https://developers.digitalocean.com/droplets/",
+	) {
+		if !strings.Contains(usage, expected) {
+			t.Errorf("Usage(droplets snapshot) is missing %q", expected)
+		}
+	}
+}
+
+func TestEveryRouteHasHelp(t *testing.T) {
+	InitRoutingTable()
+	for _, route := range RoutingTable {
+		if route.HelpText == "" || len(route.Examples) == 0 {
+			t.Errorf("route %s is missing help text or examples", strings.Join(route.Pattern, " "))
+		}
+		for _, spec := range route.Specs {
+			if spec.Description == "" {
+				t.Errorf("route %s parameter :%s has no description", strings.Join(route.Pattern, " "), spec.Name)
+			}
+		}
+	}
+}
+
+func TestRoutesWithPrefix(t *testing.T) {
+	InitRoutingTable()
+	if routes := RoutesWithPrefix(SArray("droplets")); len(routes) < 10 {
+		t.Errorf("RoutesWithPrefix(droplets) => %d routes", len(routes))
+	}
+	if routes := RoutesWithPrefix(SArray("bogus")); len(routes) != 0 {
+		t.Errorf("RoutesWithPrefix(bogus) => %d routes", len(routes))
+	}
+}
+
+func TestHelpWithoutConfig(t *testing.T) {
+	InitRoutingTable()
+	savedConfig, savedOptions, savedClient := Config, CmdlineOptions, Client
+	defer func() { Config, CmdlineOptions, Client = savedConfig, savedOptions, savedClient }()
+	CmdlineOptions.ConfigPath = "/tmp/diocean-missing/config.json"
+	CmdlineOptions.Output = OutputText
+
+	withEnv(t, nil, func() {
+		var err error
+		out := captureStdout(t, func() { err = Run(SArray("help", "droplets", "snapshot")) })
+		if err != nil || !strings.Contains(out, "Usage: diocean droplets snapshot") {
+			t.Errorf("Run(help droplets snapshot) without a config => %v, printed %q", err, out)
+		}
+
+		err = Run(SArray("dropletz", "ls"))
+		if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitUsage || !strings.Contains(exitErr.Hint, "diocean droplets ls") {
+			t.Errorf("Run(dropletz ls) without a config => %#v", err)
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// A small line editor for 'diocean shell': cursor movement, history and tab
+// completion on a terminal.  The terminal is put in raw mode with stty, only
+// while a line is being read, so commands run with it as they found it.
+
+type LineEditor struct {
+	In      *bufio.Reader
+	Out     io.Writer
+	Prompt  string
+	History []string
+	// Complete returns the replacement for the text before the cursor and
+	// the candidates to list when there is more than one.
+	Complete func(before string) (string, []string)
+
+	line   []rune
+	cursor int
+}
+
+// TerminalRawMode puts the terminal on stdin in raw mode, the returned func
+// restores it.
+func TerminalRawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+// TerminalNoEcho stops the terminal on stdin echoing what is typed, eg: a
+// secret, the returned func restores it.
+func TerminalNoEcho() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// ReadLine reads a line with editing, io.EOF when ^D is hit on an empty line.
+func (self *LineEditor) ReadLine() (string, error) {
+	restore, err := TerminalRawMode()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	self.line, self.cursor = nil, 0
+	// the entry being edited is kept past the end of the history
+	historyIdx := len(self.History)
+	draft := ""
+	self.redraw()
+
+	for {
+		r, _, err := self.In.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprintf(self.Out, "\r\n")
+			return string(self.line), nil
+		case 3: // ^C
+			fmt.Fprintf(self.Out, "^C\r\n")
+			self.line, self.cursor = nil, 0
+			historyIdx = len(self.History)
+		case 4: // ^D
+			if len(self.line) == 0 {
+				fmt.Fprintf(self.Out, "\r\n")
+				return "", io.EOF
+			}
+			self.deleteAt(self.cursor)
+		case 127, 8: // backspace
+			if self.cursor > 0 {
+				self.cursor--
+				self.deleteAt(self.cursor)
+			}
+		case 1: // ^A
+			self.cursor = 0
+		case 5: // ^E
+			self.cursor = len(self.line)
+		case 11: // ^K
+			self.line = self.line[:self.cursor]
+		case 21: // ^U
+			self.line = self.line[self.cursor:]
+			self.cursor = 0
+		case 23: // ^W
+			start := self.cursor
+			for start > 0 && self.line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && self.line[start-1] != ' ' {
+				start--
+			}
+			self.line = append(self.line[:start], self.line[self.cursor:]...)
+			self.cursor = start
+		case '\t':
+			self.complete()
+		case 27: // escape sequences: arrows, home, end and delete
+			seq := self.readEscape()
+			switch seq {
+			case "[A", "OA":
+				if historyIdx > 0 {
+					if historyIdx == len(self.History) {
+						draft = string(self.line)
+					}
+					historyIdx--
+					self.setLine(self.History[historyIdx])
+				}
+			case "[B", "OB":
+				if historyIdx < len(self.History) {
+					historyIdx++
+					if historyIdx == len(self.History) {
+						self.setLine(draft)
+					} else {
+						self.setLine(self.History[historyIdx])
+					}
+				}
+			case "[C", "OC":
+				if self.cursor < len(self.line) {
+					self.cursor++
+				}
+			case "[D", "OD":
+				if self.cursor > 0 {
+					self.cursor--
+				}
+			case "[H", "OH", "[1~":
+				self.cursor = 0
+			case "[F", "OF", "[4~":
+				self.cursor = len(self.line)
+			case "[3~":
+				self.deleteAt(self.cursor)
+			}
+		default:
+			if unicode.IsPrint(r) {
+				self.line = append(self.line[:self.cursor], append([]rune{r}, self.line[self.cursor:]...)...)
+				self.cursor++
+			}
+		}
+		self.redraw()
+	}
+}
+
+func (self *LineEditor) readEscape() string {
+	var seq []rune
+	for {
+		r, _, err := self.In.ReadRune()
+		if err != nil {
+			return string(seq)
+		}
+		seq = append(seq, r)
+		// a sequence ends with a letter or '~', after the '[' or 'O'
+		if len(seq) > 1 && (unicode.IsLetter(r) || r == '~') {
+			return string(seq)
+		}
+		if len(seq) > 8 {
+			return string(seq)
+		}
+	}
+}
+
+func (self *LineEditor) deleteAt(idx int) {
+	if idx < len(self.line) {
+		self.line = append(self.line[:idx], self.line[idx+1:]...)
+	}
+}
+
+func (self *LineEditor) setLine(line string) {
+	self.line = []rune(line)
+	self.cursor = len(self.line)
+}
+
+func (self *LineEditor) redraw() {
+	fmt.Fprintf(self.Out, "\r%s%s\x1b[K", self.Prompt, string(self.line))
+	if back := len(self.line) - self.cursor; back > 0 {
+		fmt.Fprintf(self.Out, "\x1b[%dD", back)
+	}
+}
+
+func (self *LineEditor) complete() {
+	if self.Complete == nil {
+		return
+	}
+
+	before, cands := self.Complete(string(self.line[:self.cursor]))
+	rest := self.line[self.cursor:]
+	self.line = append([]rune(before), rest...)
+	self.cursor = len([]rune(before))
+
+	if len(cands) > 1 {
+		fmt.Fprintf(self.Out, "\r\n%s\r\n", strings.Join(cands, "  "))
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// Route options are named flags for a route's parameters, eg:
+//
+//   diocean droplets new web1 --size 1gb --region nyc2
+//
+// They are registered with the command line flags so they can appear
+// anywhere, and are merged into the matched route by ResolveOptions.  A
+// parameter given neither as an argument nor as a flag falls back to the
+// config file (eg: DefaultSize) and then to the spec's Default.
+
+type RouteOptionFlag struct {
+	Spec *ParamSpec
+}
+
+func (self *RouteOptionFlag) String() string {
+	return ""
+}
+
+func (self *RouteOptionFlag) Set(s string) error {
+	if CmdlineOptions.RouteOptions == nil {
+		CmdlineOptions.RouteOptions = make(map[string]string)
+	}
+	CmdlineOptions.RouteOptions[self.Spec.Name] = s
+	return nil
+}
+
+func (self *RouteOptionFlag) IsBoolFlag() bool {
+	return self.Spec != nil && self.Spec.Type == ParamBool
+}
+
+// FlagName is the option's name on the command line, without the dashes.
+func (self *ParamSpec) FlagName() string {
+	if self.Flag != "" {
+		return self.Flag
+	}
+	return strings.Replace(self.Name, "_", "-", -1)
+}
+
+// ConfigKey is the key of the parameter's default value in the config file,
+// eg: ssh_key_ids => DefaultSshKeyIds
+func (self *ParamSpec) ConfigKey() string {
+	key := "Default"
+	for _, word := range strings.Split(self.Name, "_") {
+		if word != "" {
+			key += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return key
+}
+
+// FindRouteOption finds the spec of an option by its flag name across the
+// RoutingTable.
+func FindRouteOption(flagName string) *ParamSpec {
+	for _, route := range RoutingTable {
+		for _, spec := range route.Options {
+			if spec.FlagName() == flagName {
+				return spec
+			}
+		}
+	}
+	return nil
+}
+
+// RegisterRouteOptions adds the options of every route to the flag set.
+func RegisterRouteOptions(flags *flag.FlagSet) {
+	for _, route := range RoutingTable {
+		for _, spec := range route.Options {
+			if flags.Lookup(spec.FlagName()) != nil {
+				continue
+			}
+			flags.Var(&RouteOptionFlag{spec}, spec.FlagName(), fmt.Sprintf("%s (%s)", spec.Description, strings.Join(route.CommandWords(), " ")))
+		}
+	}
+}
+
+// ResolveOptions fills in the route's parameters from the given options,
+// the config file defaults and the specs' defaults, in that order.
+// Arguments given on the command line always win.
+func (self *Route) ResolveOptions(options map[string]string) error {
+	command := strings.Join(self.CommandWords(), " ")
+
+	for name := range options {
+		if self.OptionSpec(name) == nil {
+			return fmt.Errorf("%s: unknown option --%s", command, strings.Replace(name, "_", "-", -1))
+		}
+	}
+
+	if self.ParamSources == nil {
+		self.ParamSources = make(map[string]string)
+	}
+
+	for _, spec := range self.Options {
+		value, source := self.Params[spec.Name], "argument"
+		if value == "" {
+			value, source = options[spec.Name], "--"+spec.FlagName()
+		}
+		if value == "" {
+			value, source = Config.Get(spec.ConfigKey()), "config "+spec.ConfigKey()
+		}
+		if value == "" {
+			value, source = spec.Default, "default"
+		}
+
+		if value == "" && spec.Required {
+			return fmt.Errorf("%s: missing required parameter :%s (%s), give it as an argument, with --%s or as %s in the config file",
+				command, spec.Name, spec.Description, spec.FlagName(), spec.ConfigKey())
+		}
+
+		if err := spec.Validate(value); err != nil {
+			return fmt.Errorf("%s: %s", command, err)
+		}
+		self.Params[spec.Name] = value
+		if value != "" {
+			self.ParamSources[spec.Name] = source
+		}
+	}
+
+	return nil
+}
+
+// ResolvedParams describes the route's effective parameters and where each
+// value came from, eg:
+//
+//   size     1gb      config DefaultSize
+func (self *Route) ResolvedParams() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s\n", strings.Join(self.CommandWords(), " "))
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	for _, spec := range self.Specs {
+		values := self.ParamValues(spec.Name)
+		if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+			continue
+		}
+		source, ok := self.ParamSources[spec.Name]
+		if !ok {
+			source = "argument"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", spec.Name, strings.Join(values, " "), source)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+func (self *Route) OptionSpec(name string) *ParamSpec {
+	for _, spec := range self.Options {
+		if spec.Name == name {
+			return spec
+		}
+	}
+	return nil
+}
+
+// WithOptions lets the given parameters also be given as named flags.
+func (self *Route) WithOptions(specs ...*ParamSpec) *Route {
+	self.Options = specs
+	return self
+}
+
+// RouteOptionCompletions completes option names ('--si' => '--size') and
+// option values ('--size 1' => '1gb'), the latter with the same candidates
+// as the positional parameter.  Returns false when the last word is not
+// part of an option.
+func RouteOptionCompletions(args []string) ([]string, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+
+	last := args[len(args)-1]
+	if spec := FindRouteOption(strings.TrimLeft(last, "-")); strings.HasPrefix(last, "-") && spec != nil && spec.Type != ParamBool {
+		return RouteOptionValues(spec, ""), true
+	}
+
+	if len(args) > 1 {
+		prev := args[len(args)-2]
+		if spec := FindRouteOption(strings.TrimLeft(prev, "-")); strings.HasPrefix(prev, "-") && spec != nil && spec.Type != ParamBool {
+			return RouteOptionValues(spec, last), true
+		}
+	}
+
+	if !strings.HasPrefix(last, "-") {
+		return nil, false
+	}
+
+	words := make([]string, 0)
+	for _, route := range FindPotentialRoutes(StripRouteOptions(args[:len(args)-1])) {
+		options := route.Options
+		if route.Alias != nil {
+			options = route.Alias.Options()
+		}
+		for _, spec := range options {
+			flagName := "--" + spec.FlagName()
+			if strings.HasPrefix(flagName, last) {
+				words = AppendUnique(words, flagName)
+			}
+		}
+	}
+	return words, true
+}
+
+func RouteOptionValues(spec *ParamSpec, prefix string) []string {
+	cands := ParameterCompletions(nil, ":"+spec.Name, prefix)
+	words := make([]string, 0)
+	for _, cand := range cands {
+		if strings.HasPrefix(cand, prefix) {
+			words = append(words, cand)
+		}
+	}
+	return words
+}
+
+// StripRouteOptions removes route options, and their values, from args.
+func StripRouteOptions(args []string) []string {
+	res := make([]string, 0)
+	for ii := 0; ii < len(args); ii++ {
+		arg := args[ii]
+		if !strings.HasPrefix(arg, "-") {
+			res = append(res, arg)
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		hasValue := strings.Contains(name, "=")
+		if hasValue {
+			name = name[:strings.Index(name, "=")]
+		}
+
+		spec := FindRouteOption(name)
+		if spec == nil {
+			res = append(res, arg)
+			continue
+		}
+
+		if !hasValue && spec.Type != ParamBool {
+			ii++
+		}
+	}
+	return res
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParamSpecConfigKey(t *testing.T) {
+	if key := SshKeyIdsParam.ConfigKey(); key != "DefaultSshKeyIds" {
+		t.Errorf("SshKeyIdsParam.ConfigKey() => %s", key)
+	}
+	if name := SshKeyIdsParam.FlagName(); name != "ssh-keys" {
+		t.Errorf("SshKeyIdsParam.FlagName() => %s", name)
+	}
+	if name := PrivateNetworkingParam.FlagName(); name != "private-networking" {
+		t.Errorf("PrivateNetworkingParam.FlagName() => %s", name)
+	}
+}
+
+func TestResolveOptions(t *testing.T) {
+	InitRoutingTable()
+	saved := Config
+	Config = MockSettings(t, map[string]string{"DefaultRegion": "nyc2", "DefaultImage": "ubuntu-14-04-x64"})
+	defer func() { Config = saved }()
+
+	// arguments win over flags, flags over the config file
+	route := FindMatchingRoute(SArray("droplets", "new", "web1", "512mb", "centos-6-5-x64"))
+	if route == nil {
+		t.Fatalf("FindMatchingRoute(droplets new web1 512mb centos-6-5-x64) found no route")
+	}
+	err := route.ResolveOptions(map[string]string{"size": "1gb", "ssh_key_ids": "12,34", "private_networking": "true"})
+	if err != nil {
+		t.Fatalf("ResolveOptions => %s", err)
+	}
+	expected := map[string]string{
+		"name":               "web1",
+		"size":               "512mb",
+		"image":              "centos-6-5-x64",
+		"region":             "nyc2",
+		"ssh_key_ids":        "12,34",
+		"private_networking": "true",
+		"backups_enabled":    "false",
+	}
+	for name, value := range expected {
+		if route.Params[name] != value {
+			t.Errorf("ResolveOptions: %s => '%s' expected '%s'", name, route.Params[name], value)
+		}
+	}
+
+	route = FindMatchingRoute(SArray("droplets", "new", "web1"))
+	err = route.ResolveOptions(map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), ":size") || !strings.Contains(err.Error(), "DefaultSize") {
+		t.Errorf("ResolveOptions without a size => %v", err)
+	}
+
+	route = FindMatchingRoute(SArray("droplets", "new", "web1"))
+	err = route.ResolveOptions(map[string]string{"size": "1gb", "private_networking": "maybe"})
+	if err == nil || !strings.Contains(err.Error(), ":private_networking") {
+		t.Errorf("ResolveOptions with an invalid bool => %v", err)
+	}
+
+	route = FindMatchingRoute(SArray("droplets", "show", "123"))
+	err = route.ResolveOptions(map[string]string{"size": "1gb"})
+	if err == nil || !strings.Contains(err.Error(), "--size") {
+		t.Errorf("ResolveOptions with an option the route does not take => %v", err)
+	}
+}
+
+func TestStripRouteOptions(t *testing.T) {
+	InitRoutingTable()
+	args := SArray("droplets", "new", "--size", "1gb", "web1", "--private-networking", "--region=nyc2", "-w")
+	expected := SArray("droplets", "new", "web1", "-w")
+	if res := StripRouteOptions(args); !StringArraysMatch(expected, res) {
+		t.Errorf("StripRouteOptions(%s) => %s", args, res)
+	}
+}
+
+func TestRouteOptionCompletions(t *testing.T) {
+	InitRoutingTable()
+	CreateMockCachedResponse(t, "DropletSizes")
+	defer RemoveFromDiskCache("DropletSizes")
+
+	words, isOption := RouteOptionCompletions(SArray("droplets", "new", "web1", "--si"))
+	if !isOption || !StringArraysMatch(SArray("--size"), words) {
+		t.Errorf("RouteOptionCompletions(--si) => %s %v", words, isOption)
+	}
+
+	words, isOption = RouteOptionCompletions(SArray("droplets", "new", "web1", "--size", "1"))
+	if !isOption || !StringArraysMatch(SArray("1gb", "16gb"), words) {
+		t.Errorf("RouteOptionCompletions(--size 1) => %s %v", words, isOption)
+	}
+
+	_, isOption = RouteOptionCompletions(SArray("droplets", "new", "web1", "--private-networking", "5"))
+	if isOption {
+		t.Errorf("RouteOptionCompletions(--private-networking 5) should not complete an option")
+	}
+}
+
+func TestResolvedParams(t *testing.T) {
+	InitRoutingTable()
+	saved := Config
+	Config = MockSettings(t, map[string]string{"DefaultRegion": "nyc2", "DefaultImage": "ubuntu-14-04-x64", "DefaultSize": "1gb", "DefaultSshKeyIds": "12,34"})
+	defer func() { Config = saved }()
+
+	route := FindMatchingRoute(SArray("droplets", "new", "web3"))
+	if err := route.ResolveOptions(map[string]string{"region": "ams2"}); err != nil {
+		t.Fatalf("ResolveOptions => %s", err)
+	}
+
+	resolved := route.ResolvedParams()
+	t.Logf("ResolvedParams =>\n%s", resolved)
+	for _, expected := range SArray("web3", "argument", "config DefaultSize", "ams2", "--region", "12,34", "config DefaultSshKeyIds", "false", "default") {
+		if !strings.Contains(resolved, expected) {
+			t.Errorf("ResolvedParams does not mention '%s':\n%s", expected, resolved)
+		}
+	}
+}
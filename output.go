@@ -0,0 +1,503 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+const (
+	OutputText     = "text"
+	OutputJson     = "json"
+	OutputTemplate = "template"
+	OutputColumns  = "columns"
+	OutputTable    = "table"
+	OutputCsv      = "csv"
+	OutputYaml     = "yaml"
+)
+
+var OutputFormats = []string{OutputText, OutputTable, OutputJson, OutputYaml, OutputCsv, OutputTemplate, OutputColumns}
+
+// Cells wider than this are truncated in table output.
+var TableMaxCellWidth = 40
+
+func IsTerminal(f *os.File) bool {
+	finfo, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return finfo.Mode()&os.ModeCharDevice != 0
+}
+
+// DefaultOutputFormat is used when -o is not given: a table for people
+// looking at a terminal, the tab-delimited text for scripts reading a pipe.
+func DefaultOutputFormat() string {
+	if IsTerminal(os.Stdout) {
+		return OutputTable
+	}
+	return OutputText
+}
+
+// ParseOutputFormat splits the -o flag into the format name and its
+// argument, eg: "columns=id,name" => ("columns", "id,name")
+func ParseOutputFormat(spec string) (format string, arg string, err error) {
+	format = spec
+	if idx := strings.Index(spec, "="); idx >= 0 {
+		format = spec[:idx]
+		arg = spec[idx+1:]
+	}
+
+	if !StringArrayContains(OutputFormats, format) {
+		return "", "", fmt.Errorf("unknown output format '%s', expected one of: %s", format, strings.Join(OutputFormats, ", "))
+	}
+
+	if (format == OutputTemplate || format == OutputColumns) && arg == "" {
+		return "", "", fmt.Errorf("output format '%s' requires an argument, eg: -o %s=...", format, format)
+	}
+
+	return format, arg, nil
+}
+
+func EmitJson(v interface{}) error {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(body)
+	fmt.Printf("\n")
+	return nil
+}
+
+// EmitResponse renders a response object in the selected output format.  In
+// text mode fetchFn is not called, textFn (the client library's own
+// tab-delimited printer) is used instead and the calls it makes are checked,
+// see PrintChecked.  Only list responses can be shown as a table, see
+// EmitListResponse, everything else falls back to text.
+func EmitResponse(fetchFn PerformCall, textFn func()) error {
+	format := CmdlineOptions.OutputFormat
+	if !CmdlineOptions.Quiet && (format == OutputText || format == OutputTable) {
+		return PrintChecked(textFn)
+	}
+
+	resp, err := fetchFn()
+	if err != nil {
+		return err
+	}
+
+	if CmdlineOptions.Quiet {
+		EmitIds(resp)
+		return nil
+	}
+
+	switch format {
+	case OutputJson:
+		return EmitJson(resp)
+	case OutputYaml:
+		return EmitYaml(resp)
+	case OutputCsv:
+		err = EmitCsv(resp, CmdlineOptions.OutputArg)
+	case OutputTemplate:
+		err = EmitTemplate(resp, CmdlineOptions.OutputArg)
+	case OutputColumns:
+		err = EmitColumns(resp, strings.Split(CmdlineOptions.OutputArg, ","))
+	}
+	// eg: an unknown column or a broken template
+	return WithExitCode(ExitUsage, err)
+}
+
+// EmitApiCall performs a call against the HTTP API for structured output,
+// waiting on the resulting event when -w was given.
+func EmitApiCall(path string, params url.Values, textFn func()) error {
+	return EmitResponse(func() (interface{}, error) {
+		resp, err := ApiCall(path, params)
+		if err != nil {
+			return nil, err
+		}
+
+		eventId, hasEvent := resp.EventId()
+		if hasEvent && CmdlineOptions.WaitForEvents {
+			if _, err = ApiWaitForEvent(eventId); err != nil {
+				return nil, err
+			}
+		}
+
+		return resp, nil
+	}, textFn)
+}
+
+// EmitIds prints only identifiers, for -q: the id of each record of a list
+// response, the resource id of a new or shown object, or the event id of an
+// action.
+func EmitIds(resp interface{}) {
+	if apiResp, ok := resp.(ApiResponse); ok {
+		if id, found := apiResp["event_id"].(float64); found {
+			fmt.Printf("%.f\n", id)
+			return
+		}
+		if id, found := apiResp.ResourceId(); found {
+			fmt.Printf("%s\n", id)
+		}
+		return
+	}
+
+	rows, rowType, isList := ResponseRows(resp)
+	if !isList {
+		return
+	}
+
+	idx, found := RowFieldIndex(rowType, "id")
+	if !found {
+		return
+	}
+
+	for _, row := range rows {
+		fmt.Printf("%s\n", FormatFieldValue(row.Field(idx)))
+	}
+}
+
+// EmitListResponse is EmitResponse for the list commands, which also support
+// table output and --filter / --sort.  defaultColumns are shown unless
+// -o table=<field,..> was given.
+func EmitListResponse(defaultColumns []string, fetchFn PerformCall, textFn func()) error {
+	filtered := len(CmdlineOptions.Filters) > 0 || CmdlineOptions.Sort != ""
+	if filtered {
+		unfilteredFn := fetchFn
+		fetchFn = func() (interface{}, error) {
+			resp, err := unfilteredFn()
+			if err != nil {
+				return nil, err
+			}
+			resp, err = FilterAndSortResponse(resp, CmdlineOptions.Filters, CmdlineOptions.Sort)
+			return resp, WithExitCode(ExitUsage, err)
+		}
+	}
+
+	columns := defaultColumns
+	switch {
+	case CmdlineOptions.Quiet:
+		return EmitResponse(fetchFn, textFn)
+	case CmdlineOptions.OutputFormat == OutputTable:
+		if CmdlineOptions.OutputArg != "" {
+			columns = strings.Split(CmdlineOptions.OutputArg, ",")
+		}
+	case CmdlineOptions.OutputFormat != OutputText || !filtered:
+		return EmitResponse(fetchFn, textFn)
+	}
+
+	// a table, or text of the filtered records without a header: the client
+	// library can only print everything
+	resp, err := fetchFn()
+	if err != nil {
+		return err
+	}
+	if CmdlineOptions.OutputFormat == OutputTable {
+		return WithExitCode(ExitUsage, EmitTable(resp, columns))
+	}
+	return WithExitCode(ExitUsage, EmitRows(resp, columns))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// list responses
+
+// ResponseRows finds the records in one of the client library's list
+// responses (eg: ActiveDropletsResponse.Droplets, SshKeysResponse.Ssh_keys).
+// The element type is returned as well so fields can be checked even when
+// the list is empty.
+func ResponseRows(resp interface{}) ([]reflect.Value, reflect.Type, bool) {
+	val := reflect.Indirect(reflect.ValueOf(resp))
+	if val.Kind() != reflect.Struct {
+		return nil, nil, false
+	}
+
+	for ii := 0; ii < val.NumField(); ii++ {
+		field := val.Field(ii)
+		if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Slice {
+			if field.IsNil() {
+				return []reflect.Value{}, field.Type().Elem().Elem(), true
+			}
+			field = field.Elem()
+		}
+
+		if field.Kind() != reflect.Slice {
+			continue
+		}
+
+		rows := make([]reflect.Value, field.Len())
+		for jj := range rows {
+			rows[jj] = field.Index(jj)
+		}
+		return rows, field.Type().Elem(), true
+	}
+
+	return nil, nil, false
+}
+
+// RowFieldNames lists the fields of a record, lower cased, in the form used
+// by -o columns=...
+func RowFieldNames(rowType reflect.Type) []string {
+	names := make([]string, 0)
+	for ii := 0; ii < rowType.NumField(); ii++ {
+		names = append(names, strings.ToLower(rowType.Field(ii).Name))
+	}
+	return names
+}
+
+// RowFieldIndex resolves a column name against a record type.  Matching is
+// case insensitive and the _id or _at suffix may be left off, so 'region'
+// finds Region_id and 'created' finds Created_at.
+func RowFieldIndex(rowType reflect.Type, name string) (int, bool) {
+	for _, cand := range []string{name, name + "_id", name + "_at"} {
+		for ii := 0; ii < rowType.NumField(); ii++ {
+			if strings.EqualFold(rowType.Field(ii).Name, cand) {
+				return ii, true
+			}
+		}
+	}
+	return -1, false
+}
+
+func UnknownFieldError(rowType reflect.Type, name string) error {
+	return fmt.Errorf("unknown field '%s', available fields are: %s", name, strings.Join(RowFieldNames(rowType), ", "))
+}
+
+func FormatFieldValue(val reflect.Value) string {
+	switch val.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return fmt.Sprintf("%.f", val.Float())
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			return ""
+		}
+		return FormatFieldValue(val.Elem())
+	}
+	return fmt.Sprintf("%v", val.Interface())
+}
+
+// ResponseTable resolves the given columns against a list response, returning
+// the header and the formatted rows.
+func ResponseTable(resp interface{}, columns []string) ([]string, [][]string, error) {
+	rows, rowType, isList := ResponseRows(resp)
+	if !isList {
+		return nil, nil, fmt.Errorf("column output is only supported for list commands")
+	}
+
+	indexes := make([]int, len(columns))
+	for ii, col := range columns {
+		idx, found := RowFieldIndex(rowType, strings.TrimSpace(col))
+		if !found {
+			return nil, nil, UnknownFieldError(rowType, col)
+		}
+		indexes[ii] = idx
+	}
+
+	header := make([]string, len(columns))
+	for ii, idx := range indexes {
+		header[ii] = strings.ToLower(rowType.Field(idx).Name)
+	}
+
+	table := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		line := make([]string, len(indexes))
+		for ii, idx := range indexes {
+			line[ii] = FormatFieldValue(row.Field(idx))
+		}
+		table = append(table, line)
+	}
+
+	return header, table, nil
+}
+
+// EmitRows prints the given columns of a list response, tab-delimited and
+// without a header.
+func EmitRows(resp interface{}, columns []string) error {
+	_, table, err := ResponseTable(resp, columns)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range table {
+		fmt.Printf("%s\n", strings.Join(line, "\t"))
+	}
+	return nil
+}
+
+func EmitColumns(resp interface{}, columns []string) error {
+	header, table, err := ResponseTable(resp, columns)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\n", strings.Join(header, "\t"))
+	for _, line := range table {
+		fmt.Printf("%s\n", strings.Join(line, "\t"))
+	}
+	return nil
+}
+
+// FlattenFieldNames lists the csv columns for a record type.  Nested structs
+// are flattened into parent.child columns, everything is lower cased.
+func FlattenFieldNames(rowType reflect.Type, prefix string) []string {
+	names := make([]string, 0)
+	for ii := 0; ii < rowType.NumField(); ii++ {
+		field := rowType.Field(ii)
+		name := prefix + strings.ToLower(field.Name)
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct {
+			names = append(names, FlattenFieldNames(fieldType, name+".")...)
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// FlattenFieldValues returns the values of a record in the same order as
+// FlattenFieldNames.  Lists are joined with ';' and maps are written as
+// key=value pairs joined with ';', sorted by key.
+func FlattenFieldValues(row reflect.Value) []string {
+	values := make([]string, 0)
+	for ii := 0; ii < row.NumField(); ii++ {
+		field := row.Field(ii)
+		fieldType := row.Type().Field(ii).Type
+		if fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct {
+			if field.IsNil() {
+				field = reflect.Zero(fieldType.Elem())
+			} else {
+				field = field.Elem()
+			}
+		}
+		if field.Kind() == reflect.Struct {
+			values = append(values, FlattenFieldValues(field)...)
+			continue
+		}
+		values = append(values, FlattenValue(field))
+	}
+	return values
+}
+
+func FlattenValue(val reflect.Value) string {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			return ""
+		}
+		return FlattenValue(val.Elem())
+	case reflect.Slice, reflect.Array:
+		parts := make([]string, val.Len())
+		for ii := range parts {
+			parts[ii] = FlattenValue(val.Index(ii))
+		}
+		return strings.Join(parts, ";")
+	case reflect.Map:
+		parts := make([]string, 0, val.Len())
+		for _, key := range val.MapKeys() {
+			parts = append(parts, fmt.Sprintf("%v=%s", key.Interface(), FlattenValue(val.MapIndex(key))))
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ";")
+	}
+	return FormatFieldValue(val)
+}
+
+// EmitCsv writes a list response as csv with a header row.  All of the
+// (flattened) fields are written unless columns were given with -o csv=...
+func EmitCsv(resp interface{}, columns string) error {
+	var header []string
+	var table [][]string
+
+	if columns != "" {
+		var err error
+		header, table, err = ResponseTable(resp, strings.Split(columns, ","))
+		if err != nil {
+			return err
+		}
+	} else {
+		rows, rowType, isList := ResponseRows(resp)
+		if !isList {
+			return fmt.Errorf("csv output is only supported for list commands")
+		}
+		header = FlattenFieldNames(rowType, "")
+		for _, row := range rows {
+			table = append(table, FlattenFieldValues(row))
+		}
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write(header)
+	w.WriteAll(table)
+	return w.Error()
+}
+
+func TruncateCell(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width || width < 4 {
+		return s
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// EmitTable prints a list response with a header row and aligned columns.
+func EmitTable(resp interface{}, columns []string) error {
+	header, table, err := ResponseTable(resp, columns)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for ii, col := range header {
+		header[ii] = strings.ToUpper(col)
+	}
+	fmt.Fprintf(w, "%s\n", strings.Join(header, "\t"))
+	for _, line := range table {
+		for ii, cell := range line {
+			line[ii] = TruncateCell(cell, TableMaxCellWidth)
+		}
+		fmt.Fprintf(w, "%s\n", strings.Join(line, "\t"))
+	}
+	return w.Flush()
+}
+
+// EmitTemplate executes a text/template once per record for list responses,
+// or once against the whole response for everything else.
+func EmitTemplate(resp interface{}, text string) error {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return err
+	}
+
+	rows, rowType, isList := ResponseRows(resp)
+	if !isList {
+		err = tmpl.Execute(os.Stdout, resp)
+		fmt.Printf("\n")
+		return err
+	}
+
+	for _, row := range rows {
+		err = tmpl.Execute(os.Stdout, row.Interface())
+		if err != nil {
+			return fmt.Errorf("%s (available fields are: %s)", err, strings.Join(StructFieldNames(rowType), ", "))
+		}
+		fmt.Printf("\n")
+	}
+	return nil
+}
+
+// StructFieldNames lists the fields of a record as they are spelled in
+// templates, eg: .Ip_address
+func StructFieldNames(rowType reflect.Type) []string {
+	names := make([]string, 0)
+	for ii := 0; ii < rowType.NumField(); ii++ {
+		names = append(names, "."+rowType.Field(ii).Name)
+	}
+	return names
+}
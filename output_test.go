@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kyleburton/diocean-go"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func MockRegionsResponse() diocean.RegionResponse {
+	var resp diocean.RegionResponse
+	resp.Unmarshal([]byte(MockApiResponses["RegionsLs"]))
+	return resp
+}
+
+// captureStdout returns whatever fn writes to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = saved }()
+
+	fn()
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+	return string(out)
+}
+
+// withApi points the API at a server answering every call with body.
+func withApi(t *testing.T, body string, fn func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	savedClient, savedUrl, savedOptions := Client, ApiBaseUrl, CmdlineOptions
+	defer func() { Client, ApiBaseUrl, CmdlineOptions = savedClient, savedUrl, savedOptions }()
+	Client = &diocean.DioceanClient{ClientId: "client-1", ApiKey: "key-1"}
+	ApiBaseUrl = server.URL
+	fn()
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	format, arg, err := ParseOutputFormat("columns=id,name")
+	if err != nil || format != OutputColumns || arg != "id,name" {
+		t.Errorf("ParseOutputFormat(columns=id,name) => %s, %s, %v", format, arg, err)
+	}
+
+	format, arg, err = ParseOutputFormat("template={{.Name}}={{.Slug}}")
+	if err != nil || format != OutputTemplate || arg != "{{.Name}}={{.Slug}}" {
+		t.Errorf("ParseOutputFormat(template=...) => %s, %s, %v", format, arg, err)
+	}
+
+	_, _, err = ParseOutputFormat("xml")
+	if err == nil {
+		t.Errorf("ParseOutputFormat(xml) expected an error")
+	}
+
+	_, _, err = ParseOutputFormat("columns")
+	if err == nil {
+		t.Errorf("ParseOutputFormat(columns) expected an error")
+	}
+}
+
+func TestResponseTable(t *testing.T) {
+	header, table, err := ResponseTable(MockRegionsResponse(), SArray("id", "Slug"))
+	if err != nil {
+		t.Fatalf("ResponseTable: %s", err)
+	}
+
+	if !StringArraysMatch(SArray("id", "slug"), header) {
+		t.Errorf("ResponseTable header: %s", header)
+	}
+
+	if len(table) != 4 || !StringArraysMatch(SArray("3", "sfo1"), table[0]) {
+		t.Errorf("ResponseTable rows: %s", table)
+	}
+
+	_, _, err = ResponseTable(MockRegionsResponse(), SArray("id", "bogus"))
+	if err == nil || !strings.Contains(err.Error(), "slug") {
+		t.Errorf("ResponseTable expected an error listing the fields, got: %v", err)
+	}
+
+	_, _, err = ResponseTable(ApiResponse{"status": "OK"}, SArray("id"))
+	if err == nil {
+		t.Errorf("ResponseTable expected an error for a non-list response")
+	}
+}
+
+func TestTruncateCell(t *testing.T) {
+	if TruncateCell("web-1", 10) != "web-1" {
+		t.Errorf("TruncateCell should leave short values alone")
+	}
+
+	res := TruncateCell("a-very-long-droplet-name", 10)
+	if res != "a-very-..." {
+		t.Errorf("TruncateCell(a-very-long-droplet-name, 10) => %s", res)
+	}
+}
+
+func TestYamlOutput(t *testing.T) {
+	var buf bytes.Buffer
+	WriteYaml(&buf, reflect.ValueOf(MockRegionsResponse()), 0)
+	out := buf.String()
+	t.Logf("WriteYaml(regions) => %s", out)
+
+	expected := "regions:\n  - id: 3\n    name: San Francisco 1\n    slug: sfo1\n  - id: 4\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("WriteYaml(regions) :: %q does not contain %q", out, expected)
+	}
+
+	buf.Reset()
+	WriteYaml(&buf, reflect.ValueOf(ApiResponse{"status": "OK", "event_id": float64(7), "tags": []interface{}{}, "note": "yes"}), 0)
+	expected = "event_id: 7\nnote: \"yes\"\nstatus: OK\ntags: []\n"
+	if buf.String() != expected {
+		t.Errorf("WriteYaml(map) :: %q != %q", buf.String(), expected)
+	}
+}
+
+type flattenTestRecord struct {
+	Id     float64
+	Region struct {
+		Slug string
+	}
+	Tags []string
+}
+
+func TestFlattenFields(t *testing.T) {
+	var rec flattenTestRecord
+	rec.Id = 12
+	rec.Region.Slug = "nyc2"
+	rec.Tags = SArray("web", "prod")
+
+	names := FlattenFieldNames(reflect.TypeOf(rec), "")
+	if !StringArraysMatch(SArray("id", "region.slug", "tags"), names) {
+		t.Errorf("FlattenFieldNames => %s", names)
+	}
+
+	values := FlattenFieldValues(reflect.ValueOf(rec))
+	if !StringArraysMatch(SArray("12", "nyc2", "web;prod"), values) {
+		t.Errorf("FlattenFieldValues => %s", values)
+	}
+}
+
+func TestEmitChecksErrors(t *testing.T) {
+	InitRoutingTable()
+	withApi(t, `{"status": "ERROR", "error_message": "Access Denied"}`, func() {
+		for _, format := range SArray(OutputJson, OutputCsv) {
+			for _, args := range [][]string{SArray("droplets", "ls"), SArray("droplets", "reboot", "123"), SArray("events", "show", "7")} {
+				CmdlineOptions.OutputFormat = format
+				route := FindMatchingRoute(args)
+				var err error
+				out := captureStdout(t, func() { err = route.Handler(route) })
+				if ExitCode(err) != ExitAuth || out != "" {
+					t.Errorf("-o %s %q => %v, exit code %d, printed %q", format, args, err, ExitCode(err), out)
+				}
+			}
+		}
+
+		// text is printed by the client library, its calls are checked
+		UseApiTransport()
+		err := PrintChecked(func() {
+			resp, err := http.Get(ApiBaseUrl + "/droplets/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		})
+		if ExitCode(err) != ExitAuth {
+			t.Errorf("PrintChecked => %v, exit code %d", err, ExitCode(err))
+		}
+		if err := PrintChecked(func() {}); err != nil {
+			t.Errorf("PrintChecked kept the last failure: %v", err)
+		}
+	})
+
+	withApi(t, `{"status": "OK", "droplets": [{"id": 123, "name": "web1", "status": "active", "ip_address": "10.0.0.1", "region_id": 4, "size_id": 66, "image_id": 99}]}`, func() {
+		// filtered or sorted text has no header
+		CmdlineOptions.OutputFormat = OutputText
+		CmdlineOptions.Filters = SArray("name=web1")
+		CmdlineOptions.Sort = "name"
+		out := captureStdout(t, func() { DoDropletsLs(nil) })
+		if out != "123\tweb1\tactive\t10.0.0.1\t4\t66\t99\n" {
+			t.Errorf("droplets ls -o text --filter name=web1 --sort name => %q", out)
+		}
+	})
+}
+
+func TestJsonOutput(t *testing.T) {
+	InitRoutingTable()
+	cases := []struct {
+		Name     string
+		Body     string
+		Args     []string
+		Expected string
+	}{
+		{"single", `{"status": "OK", "droplet": {"name": "web1", "id": 123, "size_id": 66}}`, SArray("droplets", "show", "123"),
+			"{\n  \"droplet\": {\n    \"id\": 123,\n    \"name\": \"web1\",\n    \"size_id\": 66\n  },\n  \"status\": \"OK\"\n}\n"},
+		{"action", `{"event_id": 7, "status": "OK"}`, SArray("droplets", "reboot", "123"),
+			"{\n  \"event_id\": 7,\n  \"status\": \"OK\"\n}\n"},
+		{"list", `{"status": "OK", "regions": [{"id": 3, "name": "San Francisco 1", "slug": "sfo1"}, {"id": 4, "name": "New York 2", "slug": "nyc2"}]}`, SArray("regions", "ls"), ""},
+		{"empty list", `{"status": "OK", "regions": []}`, SArray("regions", "ls"), ""},
+	}
+
+	for _, tc := range cases {
+		withApi(t, tc.Body, func() {
+			CmdlineOptions.OutputFormat = OutputJson
+			outputs := make([]string, 0)
+			for ii := 0; ii < 2; ii++ {
+				route := FindMatchingRoute(tc.Args)
+				var err error
+				out := captureStdout(t, func() { err = route.Handler(route) })
+				if err != nil {
+					t.Fatalf("%s: -o json %q => %s", tc.Name, tc.Args, err)
+				}
+				outputs = append(outputs, out)
+			}
+
+			if !json.Valid([]byte(outputs[0])) {
+				t.Errorf("%s: -o json %q is not valid json: %s", tc.Name, tc.Args, outputs[0])
+			}
+			if outputs[0] != outputs[1] {
+				t.Errorf("%s: -o json %q is not stable: %q then %q", tc.Name, tc.Args, outputs[0], outputs[1])
+			}
+			if tc.Expected != "" && outputs[0] != tc.Expected {
+				t.Errorf("%s: -o json %q => %q, expected %q", tc.Name, tc.Args, outputs[0], tc.Expected)
+			}
+		})
+	}
+
+	// a list is the client library's response, with its records
+	withApi(t, cases[2].Body, func() {
+		CmdlineOptions.OutputFormat = OutputJson
+		out := captureStdout(t, func() { DoRegionsLs(nil) })
+		var resp diocean.RegionResponse
+		if err := json.Unmarshal([]byte(out), &resp); err != nil || len(resp.Regions) != 2 || resp.Regions[1].Slug != "nyc2" {
+			t.Errorf("regions ls -o json => %s, %v", out, err)
+		}
+	})
+}
+
+func TestEmitIds(t *testing.T) {
+	unmarshal := func(body string, resp interface{}) interface{} {
+		if err := json.Unmarshal([]byte(body), resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	cases := []struct {
+		Name     string
+		Resp     interface{}
+		Expected string
+	}{
+		{"sizes", unmarshal(MockApiResponses["DropletSizes"], &diocean.DropletSizesResponse{}), "66\n63\n62\n64\n65\n61\n60\n70\n69\n"},
+		{"droplets", unmarshal(MockApiResponses["DropletsLs"], &diocean.ActiveDropletsResponse{}), "123\n456\n"},
+		{"images", unmarshal(`{"Images": [{"Id": 3240036, "Slug": "ubuntu-14-04-x64"}, {"Id": 12}]}`, &diocean.ImagesResponse{}), "3240036\n12\n"},
+		{"regions", MockRegionsResponse(), "3\n4\n5\n6\n"},
+		{"ssh keys", unmarshal(`{"Ssh_keys": [{"Id": 21, "Name": "laptop"}]}`, &diocean.SshKeysResponse{}), "21\n"},
+		{"no droplets", unmarshal(`{"Droplets": []}`, &diocean.ActiveDropletsResponse{}), ""},
+		{"no ssh keys", &diocean.SshKeysResponse{}, ""},
+		{"droplet", ApiResponse{"status": "OK", "droplet": map[string]interface{}{"id": float64(123), "name": "web1"}}, "123\n"},
+		{"new droplet", ApiResponse{"status": "OK", "droplet": map[string]interface{}{"id": float64(456), "event_id": float64(8)}}, "456\n"},
+		{"action", ApiResponse{"status": "OK", "event_id": float64(7)}, "7\n"},
+		{"no id", ApiResponse{"status": "OK"}, ""},
+	}
+
+	for _, tc := range cases {
+		out := captureStdout(t, func() { EmitIds(tc.Resp) })
+		if out != tc.Expected {
+			t.Errorf("EmitIds(%s) => %q, expected %q", tc.Name, out, tc.Expected)
+		}
+	}
+
+	if id, found := (ApiResponse{"image": map[string]interface{}{"id": float64(12)}}).ResourceId(); !found || id != "12" {
+		t.Errorf("ResourceId(image) => %s, %t", id, found)
+	}
+	if _, found := (ApiResponse{"status": "OK", "event_id": float64(7)}).ResourceId(); found {
+		t.Errorf("ResourceId(action) should find no resource")
+	}
+}
+
+func TestDefaultOutputFormat(t *testing.T) {
+	saved := os.Stdout
+	defer func() { os.Stdout = saved }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	os.Stdout = w
+	if format := DefaultOutputFormat(); format != OutputText {
+		t.Errorf("DefaultOutputFormat() piped => %s, expected %s", format, OutputText)
+	}
+
+	file, err := ioutil.TempFile("", "diocean-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	os.Stdout = file
+	if format := DefaultOutputFormat(); format != OutputText {
+		t.Errorf("DefaultOutputFormat() to a file => %s, expected %s", format, OutputText)
+	}
+
+	// the master side of a pseudo terminal
+	tty, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminal: %s", err)
+	}
+	defer tty.Close()
+	os.Stdout = tty
+	if format := DefaultOutputFormat(); format != OutputTable {
+		t.Errorf("DefaultOutputFormat() on a terminal => %s, expected %s", format, OutputTable)
+	}
+}
+
+func TestEmitTable(t *testing.T) {
+	saved := TableMaxCellWidth
+	defer func() { TableMaxCellWidth = saved }()
+	TableMaxCellWidth = 10
+
+	var err error
+	out := captureStdout(t, func() { err = EmitTable(MockRegionsResponse(), SArray("id", "name", "slug")) })
+	expected := strings.Join([]string{
+		"ID  NAME        SLUG",
+		"3   San Fra...  sfo1",
+		"4   New York 2  nyc2",
+		"5   Amsterd...  ams2",
+		"6   Singapo...  sgp1",
+		"",
+	}, "\n")
+	if err != nil || out != expected {
+		t.Errorf("EmitTable(regions) => %v\n%s\nexpected\n%s", err, out, expected)
+	}
+
+	out = captureStdout(t, func() { err = EmitTable(&diocean.SshKeysResponse{}, SArray("id", "name")) })
+	if err != nil || out != "ID  NAME\n" {
+		t.Errorf("EmitTable(no ssh keys) => %q, %v", out, err)
+	}
+
+	if err = EmitTable(MockRegionsResponse(), SArray("id", "bogus")); err == nil {
+		t.Errorf("EmitTable with an unknown column should fail")
+	}
+}
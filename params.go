@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Declarative route parameters: each Route lists the ParamSpecs for its
+// :params so arguments can be checked before the handler (and the API) ever
+// sees them.
+
+type ParamType string
+
+const (
+	ParamString   ParamType = "string"
+	ParamInt      ParamType = "int"
+	ParamBool     ParamType = "bool"
+	ParamSlug     ParamType = "slug"
+	ParamIdOrName ParamType = "id-or-name"
+	ParamIntList  ParamType = "list"
+)
+
+type ParamSpec struct {
+	Name        string
+	Type        ParamType
+	Required    bool
+	Variadic    bool
+	Description string
+	Default     string
+	Flag        string
+}
+
+// Optional is a copy of the spec that may be left off the end of a command.
+func Optional(spec *ParamSpec) *ParamSpec {
+	res := *spec
+	res.Required = false
+	return &res
+}
+
+// Variadic is a copy of the spec that accepts one or more values, it must be
+// the last parameter of a route.
+func Variadic(spec *ParamSpec) *ParamSpec {
+	res := *spec
+	res.Variadic = true
+	return &res
+}
+
+// PatternPart is how the parameter is written in a Route's Pattern:
+// :name, [:name], :name... or [:name...]
+func (self *ParamSpec) PatternPart() string {
+	part := ":" + self.Name
+	if self.Variadic {
+		part += "..."
+	}
+	if !self.Required {
+		part = "[" + part + "]"
+	}
+	return part
+}
+
+var (
+	DropletIdParam = &ParamSpec{
+		Name:        "droplet_id",
+		Type:        ParamInt,
+		Required:    true,
+		Description: "Id of the droplet, see 'droplets ls'",
+	}
+	DropletNameParam = &ParamSpec{
+		Name:        "droplet_name",
+		Type:        ParamIdOrName,
+		Required:    true,
+		Description: "Name of the droplet",
+	}
+	NewDropletNameParam = &ParamSpec{
+		Name:        "name",
+		Type:        ParamString,
+		Required:    true,
+		Description: "Hostname for the new droplet",
+	}
+	SnapshotNameParam = &ParamSpec{
+		Name:        "name",
+		Type:        ParamString,
+		Required:    true,
+		Description: "Name for the snapshot image",
+	}
+	SizeParam = &ParamSpec{
+		Name:        "size",
+		Type:        ParamSlug,
+		Required:    true,
+		Description: "Droplet size slug, see 'sizes ls'",
+	}
+	ImageParam = &ParamSpec{
+		Name:        "image",
+		Type:        ParamIdOrName,
+		Required:    true,
+		Description: "Image slug or id, see 'images ls'",
+	}
+	ImageIdParam = &ParamSpec{
+		Name:        "image_id",
+		Type:        ParamInt,
+		Required:    true,
+		Description: "Id of the image, see 'images ls'",
+	}
+	RegionParam = &ParamSpec{
+		Name:        "region",
+		Type:        ParamSlug,
+		Required:    true,
+		Description: "Region slug, see 'regions ls'",
+	}
+	SshKeyIdsParam = &ParamSpec{
+		Name:        "ssh_key_ids",
+		Type:        ParamIntList,
+		Required:    true,
+		Description: "Comma separated ids of the SSH keys to install, see 'ssh-keys ls'",
+		Flag:        "ssh-keys",
+	}
+	PrivateNetworkingParam = &ParamSpec{
+		Name:        "private_networking",
+		Type:        ParamBool,
+		Required:    true,
+		Description: "Enable private networking",
+		Default:     "false",
+	}
+	BackupsEnabledParam = &ParamSpec{
+		Name:        "backups_enabled",
+		Type:        ParamBool,
+		Required:    true,
+		Description: "Enable automatic backups",
+		Default:     "false",
+	}
+	ScrubDataParam = &ParamSpec{
+		Name:        "scrub_data",
+		Type:        ParamBool,
+		Required:    true,
+		Description: "Overwrite the droplet's disk before it is destroyed (default: false)",
+	}
+	CommandParam = &ParamSpec{
+		Name:        "command",
+		Type:        ParamString,
+		Required:    true,
+		Description: "A command, or the first words of one, eg: droplets new",
+	}
+	EventIdParam = &ParamSpec{
+		Name:        "event_id",
+		Type:        ParamInt,
+		Required:    true,
+		Description: "Id of the event, as returned by an action",
+	}
+	ProfileParam = &ParamSpec{
+		Name:        "profile",
+		Type:        ParamIdOrName,
+		Required:    true,
+		Description: "Name of a profile in the config file, see 'profile ls'",
+	}
+	BatchScriptParam = &ParamSpec{
+		Name:        "script",
+		Type:        ParamString,
+		Required:    true,
+		Description: "File of commands, one per line, - for stdin",
+	}
+	BatchVarParam = &ParamSpec{
+		Name:        "vars",
+		Type:        ParamString,
+		Required:    true,
+		Description: "NAME=value variables for the script",
+	}
+	AliasArgsParam = &ParamSpec{
+		Name:        "args",
+		Type:        ParamString,
+		Required:    true,
+		Description: "Arguments for the alias",
+	}
+	KeepGoingParam = &ParamSpec{
+		Name:        "keep_going",
+		Type:        ParamBool,
+		Description: "Run the rest of the script after a command fails",
+		Default:     "false",
+	}
+	ApiCheckParam = &ParamSpec{
+		Name:        "api",
+		Type:        ParamBool,
+		Description: "Also make an API call to check the credentials",
+		Default:     "false",
+	}
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*$`)
+var idOrNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+var intListPattern = regexp.MustCompile(`^[0-9]+(,[0-9]+)*$`)
+
+// Validate checks a single argument against the spec's type.
+func (self *ParamSpec) Validate(value string) error {
+	if value == "" {
+		if self.Required {
+			return fmt.Errorf("missing required parameter :%s (%s)", self.Name, self.Description)
+		}
+		return nil
+	}
+
+	if expected := self.Type.Expected(value); expected != "" {
+		return fmt.Errorf("invalid value '%s' for parameter :%s, expected %s", value, self.Name, expected)
+	}
+	return nil
+}
+
+// Expected describes what a value of the type looks like when value is not
+// one, otherwise it is "".
+func (self ParamType) Expected(value string) string {
+	switch self {
+	case ParamInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "an integer"
+		}
+	case ParamBool:
+		if value != "true" && value != "false" {
+			return "true or false"
+		}
+	case ParamSlug:
+		if !slugPattern.MatchString(value) {
+			return "a slug, eg: nyc2 or 512mb"
+		}
+	case ParamIdOrName:
+		if !idOrNamePattern.MatchString(value) {
+			return "an id or a name"
+		}
+	case ParamIntList:
+		if !intListPattern.MatchString(value) {
+			return "a comma separated list of integers, eg: 12,34"
+		}
+	}
+	return ""
+}
+
+// NewRoute builds a route from its literal command words and the specs of
+// its parameters, which are appended to the pattern in order.
+func NewRoute(command string, handler RouteHandler, specs ...*ParamSpec) *Route {
+	route := &Route{
+		Pattern: strings.Fields(command),
+		Params:  make(map[string]string),
+		Handler: handler,
+		Specs:   specs,
+	}
+
+	for _, spec := range specs {
+		route.Pattern = append(route.Pattern, spec.PatternPart())
+	}
+
+	if len(specs) > 0 {
+		route.CompletionsFn = ParameterCompletions
+	}
+
+	return route
+}
+
+func (self *Route) ParamSpec(name string) *ParamSpec {
+	for _, spec := range self.Specs {
+		if spec.Name == name {
+			return spec
+		}
+	}
+	return nil
+}
+
+// ValidateParams checks the matched arguments against the route's specs.
+func (self *Route) ValidateParams() error {
+	for _, spec := range self.Specs {
+		for _, value := range self.ParamValues(spec.Name) {
+			if err := spec.Validate(value); err != nil {
+				return fmt.Errorf("%s: %s", strings.Join(self.CommandWords(), " "), err)
+			}
+		}
+	}
+	return nil
+}
+
+// ParamValues returns every value given for a variadic parameter, or the
+// single value of any other parameter.
+func (self *Route) ParamValues(name string) []string {
+	if values, ok := self.VarParams[name]; ok {
+		return values
+	}
+	return []string{self.Params[name]}
+}
+
+// CommandWords is the literal part of the route's pattern, eg: droplets new
+func (self *Route) CommandWords() []string {
+	words := make([]string, 0)
+	for _, part := range self.Pattern {
+		if IsPatternParam(part) {
+			break
+		}
+		words = append(words, part)
+	}
+	return words
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParamSpecValidate(t *testing.T) {
+	valid := map[*ParamSpec][]string{
+		DropletIdParam:      SArray("123"),
+		ScrubDataParam:      SArray("true", "false"),
+		SizeParam:           SArray("512mb", "1gb"),
+		ImageParam:          SArray("ubuntu-14-04-x64", "3240036"),
+		SshKeyIdsParam:      SArray("12", "12,34"),
+		NewDropletNameParam: SArray("web1"),
+	}
+	for spec, values := range valid {
+		for _, value := range values {
+			if err := spec.Validate(value); err != nil {
+				t.Errorf("%s.Validate(%s) => %s", spec.Name, value, err)
+			}
+		}
+	}
+
+	invalid := map[*ParamSpec][]string{
+		DropletIdParam:         SArray("abc", ""),
+		ScrubDataParam:         SArray("maybe", "yes"),
+		SizeParam:              SArray("512 MB"),
+		SshKeyIdsParam:         SArray("12,", "a,b"),
+		PrivateNetworkingParam: SArray("1"),
+	}
+	for spec, values := range invalid {
+		for _, value := range values {
+			err := spec.Validate(value)
+			if err == nil || !strings.Contains(err.Error(), ":"+spec.Name) {
+				t.Errorf("%s.Validate(%s) expected an error naming the parameter, got: %v", spec.Name, value, err)
+			}
+		}
+	}
+}
+
+func TestRouteValidateParams(t *testing.T) {
+	InitRoutingTable()
+
+	route := FindMatchingRoute(SArray("droplets", "destroy", "123", "maybe"))
+	if route == nil {
+		t.Fatalf("FindMatchingRoute(droplets destroy 123 maybe) found no route")
+	}
+	err := route.ValidateParams()
+	if err == nil || !strings.Contains(err.Error(), ":scrub_data") {
+		t.Errorf("ValidateParams(droplets destroy 123 maybe) => %v", err)
+	}
+
+	route = FindMatchingRoute(SArray("droplets", "new", "x", "1gb", "img", "nyc2", "1", "yes", "no"))
+	err = route.ValidateParams()
+	if err == nil || !strings.Contains(err.Error(), ":private_networking") {
+		t.Errorf("ValidateParams(droplets new x 1gb img nyc2 1 yes no) => %v", err)
+	}
+
+	route = FindMatchingRoute(SArray("droplets", "new", "x", "1gb", "img", "nyc2", "1,2", "true", "false"))
+	if err = route.ValidateParams(); err != nil {
+		t.Errorf("ValidateParams(droplets new ...) => %s", err)
+	}
+}
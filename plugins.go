@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Plugins: a command diocean doesn't know is run as a diocean-<name>
+// executable on the PATH, the way git runs git-<name>, eg:
+//
+//   diocean -profile prod dns add example.com --ttl 60
+//
+// runs 'diocean-dns add example.com --ttl 60'.  Flags before the command are
+// diocean's, those after it are left for the plugin.  The plugin is told
+// which config and profile are in use, see PluginEnv.  Built in commands
+// can't be replaced.
+
+var PluginPrefix = "diocean-"
+
+type Plugin struct {
+	Name string
+	Path string
+}
+
+// FindPlugins lists the plugins on the PATH, by name.  The first of a name
+// on the PATH is the one that runs.
+func FindPlugins() []Plugin {
+	plugins := make([]Plugin, 0)
+	seen := make(map[string]bool)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := strings.TrimPrefix(entry.Name(), PluginPrefix)
+			if name == entry.Name() || name == "" || seen[name] || IsBuiltinCommand(name) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !IsExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, Plugin{Name: name, Path: path})
+		}
+	}
+	sort.Slice(plugins, func(ii, jj int) bool { return plugins[ii].Name < plugins[jj].Name })
+	return plugins
+}
+
+// FindPlugin finds the plugin for a command, nil when there is none.
+func FindPlugin(name string) *Plugin {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsRune(name, filepath.Separator) || IsBuiltinCommand(name) {
+		return nil
+	}
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return nil
+	}
+	return &Plugin{Name: name, Path: path}
+}
+
+// IsBuiltinCommand is true when a route starts with the word, eg: 'droplets'.
+func IsBuiltinCommand(word string) bool {
+	for _, route := range RoutingTable {
+		if len(route.Pattern) > 0 && route.Pattern[0] == word {
+			return true
+		}
+	}
+	return false
+}
+
+func IsExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// PluginCompletions are the plugin names starting with word, for the first
+// word of a command line.
+func PluginCompletions(word string) []string {
+	words := make([]string, 0)
+	for _, plugin := range FindPlugins() {
+		if strings.HasPrefix(plugin.Name, word) {
+			words = append(words, plugin.Name)
+		}
+	}
+	return words
+}
+
+// ParseCommandLine parses the flags in args, as ParseInterspersedFlags does,
+// except that everything after the name of a plugin, or an alias, is left
+// for it.
+func ParseCommandLine(flags *flag.FlagSet, args []string) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	rest := flags.Args()
+	consumed := len(args) - len(rest)
+	if len(rest) == 0 || (consumed > 0 && args[consumed-1] == "--") || FindPlugin(rest[0]) != nil || FindAlias(rest[0]) != nil {
+		return rest, nil
+	}
+	return ParseInterspersedFlags(flags, rest)
+}
+
+// PluginEnv is the environment of a plugin: diocean's, with the settings in
+// use, so that a diocean the plugin runs reads the same ones:
+//
+//   DIOCEAN_CONFIG           the config file
+//   DIOCEAN_PROFILE          the active profile, "" for none
+//   DIOCEAN_CLIENT_ID        the client id in use
+//   DIOCEAN_API_KEY          the api key in use
+//   DIOCEAN_CACHE_DIRECTORY  the cache directory in use
+//   DIOCEAN_BIN              this diocean executable
+//
+// The credentials override any profile, so a '$DIOCEAN_BIN -profile staging
+// ...' still uses this profile's account, a plugin that switches profiles
+// has to unset them first.
+func PluginEnv() []string {
+	values := map[string]string{
+		"DIOCEAN_CONFIG":          CmdlineOptions.ConfigPath,
+		"DIOCEAN_PROFILE":         ActiveProfile,
+		"DIOCEAN_CLIENT_ID":       Config.ClientId,
+		"DIOCEAN_API_KEY":         Config.ApiKey,
+		"DIOCEAN_CACHE_DIRECTORY": PluginCacheDirectory(),
+	}
+	if bin, err := os.Executable(); err == nil {
+		values["DIOCEAN_BIN"] = bin
+	}
+
+	env := make([]string, 0)
+	for _, entry := range os.Environ() {
+		name := strings.SplitN(entry, "=", 2)[0]
+		if _, ok := values[name]; !ok {
+			env = append(env, entry)
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+values[name])
+	}
+	return env
+}
+
+// Run runs the plugin with diocean's stdin, stdout and stderr, a failure
+// exits diocean with the plugin's exit code.
+func (self *Plugin) Run(args []string) error {
+	cmd := exec.Command(self.Path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = PluginEnv()
+	Debugf("Running plugin: %s %s\n", self.Path, strings.Join(args, " "))
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return &ExitError{Code: exitErr.ExitCode(), Err: fmt.Errorf("%s%s exited with status %d", PluginPrefix, self.Name, exitErr.ExitCode())}
+	}
+	if err != nil {
+		return fmt.Errorf("%s%s: %w", PluginPrefix, self.Name, err)
+	}
+	return nil
+}
+
+// PluginCacheDirectory is DIOCEAN_CACHE_DIRECTORY for a plugin, the cache
+// directory in use, less the profile's own directory: a diocean given
+// DIOCEAN_PROFILE adds that back, see ApplyEnvOverrides.
+func PluginCacheDirectory() string {
+	dir := Config.CacheDirectory
+	if CmdlineOptions.CachePath.IsSet {
+		dir = CmdlineOptions.CachePath.Value
+	}
+	if dir == "" {
+		dir = DefaultCacheDirectory()
+	}
+	if ActiveProfile != "" && filepath.Base(dir) == ActiveProfile {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withPlugins puts two directories of plugins on the PATH:
+//
+//   bin1: diocean-dns, diocean-droplets (a built in command), diocean-notes
+//         (not executable)
+//   bin2: diocean-dns (behind bin1's), diocean-lb
+func withPlugins(t *testing.T, script string, fn func(bin1, bin2 string)) {
+	dir, err := ioutil.TempDir("", "diocean-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bin1, bin2 := filepath.Join(dir, "bin1"), filepath.Join(dir, "bin2")
+	files := []struct {
+		Path string
+		Mode os.FileMode
+	}{
+		{filepath.Join(bin1, "diocean-dns"), 0755},
+		{filepath.Join(bin1, "diocean-droplets"), 0755},
+		{filepath.Join(bin1, "diocean-notes"), 0644},
+		{filepath.Join(bin2, "diocean-dns"), 0755},
+		{filepath.Join(bin2, "diocean-lb"), 0755},
+	}
+	for _, file := range files {
+		if err := EnsureDirectory(filepath.Dir(file.Path)); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file.Path, []byte("#!/bin/sh\n"+script), file.Mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	savedPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", savedPath)
+	os.Setenv("PATH", bin1+string(filepath.ListSeparator)+bin2)
+	fn(bin1, bin2)
+}
+
+func TestFindPlugins(t *testing.T) {
+	InitRoutingTable()
+	withPlugins(t, "", func(bin1, bin2 string) {
+		plugins := FindPlugins()
+		names := make([]string, 0)
+		for _, plugin := range plugins {
+			names = append(names, plugin.Name)
+		}
+		if !StringArraysMatch(SArray("dns", "lb"), names) {
+			t.Fatalf("FindPlugins() => %v", plugins)
+		}
+		if plugins[0].Path != filepath.Join(bin1, "diocean-dns") {
+			t.Errorf("FindPlugins() should find the first diocean-dns on the PATH => %s", plugins[0].Path)
+		}
+
+		if plugin := FindPlugin("lb"); plugin == nil || plugin.Path != filepath.Join(bin2, "diocean-lb") {
+			t.Errorf("FindPlugin(lb) => %v", plugin)
+		}
+		for _, name := range SArray("droplets", "notes", "frob", "-o", "") {
+			if plugin := FindPlugin(name); plugin != nil {
+				t.Errorf("FindPlugin(%q) => %v, expected none", name, plugin)
+			}
+		}
+
+		words := FindCompletionWords(SArray("d"))
+		if !StringArraysMatch(SArray("dns", "droplets"), words) {
+			t.Errorf("FindCompletionWords(d) => %v", words)
+		}
+	})
+}
+
+func TestParseCommandLine(t *testing.T) {
+	InitRoutingTable()
+	withPlugins(t, "", func(bin1, bin2 string) {
+		cases := []struct {
+			Args     []string
+			Expected []string
+			Output   string
+		}{
+			{SArray("-o", "json", "dns", "add", "--ttl", "60", "-o", "yaml"), SArray("dns", "add", "--ttl", "60", "-o", "yaml"), "json"},
+			{SArray("droplets", "ls", "-o", "json"), SArray("droplets", "ls"), "json"},
+			{SArray("-o", "json", "--", "frob", "-o", "yaml"), SArray("frob", "-o", "yaml"), "json"},
+		}
+
+		for _, tc := range cases {
+			var output string
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.StringVar(&output, "o", "", "")
+			args, err := ParseCommandLine(flags, tc.Args)
+			if err != nil || !StringArraysMatch(tc.Expected, args) || output != tc.Output {
+				t.Errorf("ParseCommandLine(%q) => %q -o %s, %v, expected %q -o %s", tc.Args, args, output, err, tc.Expected, tc.Output)
+			}
+		}
+	})
+}
+
+func TestPluginRun(t *testing.T) {
+	InitRoutingTable()
+	savedConfig, savedOptions, savedProfile := Config, CmdlineOptions, ActiveProfile
+	defer func() { Config, CmdlineOptions, ActiveProfile = savedConfig, savedOptions, savedProfile }()
+	Config = MockSettings(t, map[string]string{"ClientId": "client-1", "ApiKey": "key-1", "CacheDirectory": "/tmp/diocean-cache/prod"})
+	ActiveProfile = "prod"
+	CmdlineOptions.Output = OutputText
+	CmdlineOptions.ConfigPath = "/tmp/plugins.json"
+
+	out, err := ioutil.TempFile("", "diocean-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	script := `echo "$DIOCEAN_PROFILE $DIOCEAN_CONFIG $DIOCEAN_CLIENT_ID $DIOCEAN_API_KEY $DIOCEAN_CACHE_DIRECTORY $*" > ` + out.Name() + `
+exit $1
+`
+	withPlugins(t, script, func(bin1, bin2 string) {
+		withEnv(t, nil, func() {
+			if err := RunRoute(nil, SArray("dns", "0", "--ttl", "60")); err != nil {
+				t.Errorf("RunRoute(dns) => %v", err)
+			}
+		})
+		content, _ := ioutil.ReadFile(out.Name())
+		// the cache directory is the base one, the profile's is added back
+		expected := "prod /tmp/plugins.json client-1 key-1 /tmp/diocean-cache 0 --ttl 60\n"
+		if string(content) != expected {
+			t.Errorf("diocean-dns ran with %q, expected %q", content, expected)
+		}
+
+		err := RunRoute(nil, SArray("lb", "5"))
+		if ExitCode(err) != ExitNotFound || !strings.Contains(err.Error(), "diocean-lb exited with status 5") {
+			t.Errorf("RunRoute(lb) => %v, exit code %d", err, ExitCode(err))
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Named profiles, eg: separate staging and production accounts, in the
+// config file:
+//
+//   {
+//     "ClientId": "...", "ApiKey": "...",
+//     "Profiles": {
+//       "prod": {"ClientId": "...", "ApiKey": "...", "DefaultRegion": "nyc2"}
+//     }
+//   }
+//
+// The top level settings are used when no profile is selected, a profile's
+// settings override them.  The profile is picked by -profile, then
+// DIOCEAN_PROFILE, then the one saved by 'diocean profile use'.
+
+var Profiles map[string]Settings
+
+// ActiveProfile is the name of the selected profile, "" when the top level
+// settings are used on their own.
+var ActiveProfile string
+
+// ProfileStatePath is where 'diocean profile use' saves the current profile.
+func ProfileStatePath() string {
+	return filepath.Join(os.Getenv("HOME"), ".digitalocean", "profile")
+}
+
+// SelectProfile picks the profile from the -profile flag, DIOCEAN_PROFILE or
+// the saved current profile, in that order.
+func SelectProfile() string {
+	if CmdlineOptions.Profile != "" {
+		return CmdlineOptions.Profile
+	}
+	if profile := os.Getenv("DIOCEAN_PROFILE"); profile != "" {
+		return profile
+	}
+	content, err := ioutil.ReadFile(ProfileStatePath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// ApplyProfile overlays a profile's settings onto the top level ones.  Each
+// named profile gets its own cache directory, a subdirectory of the top
+// level one, unless the profile sets CacheDirectory itself.
+func ApplyProfile(config Settings, profiles map[string]Settings, name string) (Settings, error) {
+	if name == "" {
+		return config, nil
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		return Settings{}, fmt.Errorf("unknown profile '%s', available profiles: %s", name, strings.Join(ProfileNames(profiles), ", "))
+	}
+
+	// a profile that gives a credential in any form replaces the top level
+	// one, eg: its ApiKeyCommand over a top level ApiKey
+	res := config
+	for _, key := range SecretKeys {
+		for _, setting := range SecretSettingKeys(key) {
+			if profile.IsSet(setting) {
+				for _, inherited := range SecretSettingKeys(key) {
+					res.Set(inherited, "")
+				}
+				break
+			}
+		}
+	}
+
+	res = res.Overlay(profile)
+
+	if !profile.IsSet("CacheDirectory") {
+		base := config.CacheDirectory
+		if base == "" {
+			base = DefaultCacheDirectory()
+		}
+		res.CacheDirectory = filepath.Join(base, name)
+	}
+
+	return res, nil
+}
+
+func DefaultCacheDirectory() string {
+	return os.Getenv("HOME") + "/.digitalocean/cache"
+}
+
+func ProfileNames(profiles map[string]Settings) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func DoProfileLs(route *Route) error {
+	for _, name := range ProfileNames(Profiles) {
+		marker := " "
+		if name == ActiveProfile {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, name)
+	}
+	return nil
+}
+
+func DoProfileUse(route *Route) error {
+	name := route.Params["profile"]
+	if _, ok := Profiles[name]; !ok {
+		return UsageError("unknown profile '%s', available profiles: %s", name, strings.Join(ProfileNames(Profiles), ", "))
+	}
+
+	statePath := ProfileStatePath()
+	if err := EnsureDirectory(filepath.Dir(statePath)); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(statePath, []byte(name+"\n"), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Using profile %s\n", name)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var MockProfilesConfig = `{
+  "ClientId": "client-0",
+  "ApiKey": "key-0",
+  "CacheMaxSeconds": 600,
+  "Profiles": {
+    "staging": {"ClientId": "client-1", "ApiKey": "key-1", "DefaultRegion": "ams2"},
+    "prod": {"ClientId": "client-2", "ApiKey": "key-2", "CacheDirectory": "/var/cache/diocean"}
+  }
+}`
+
+func TestParseConfigFileProfiles(t *testing.T) {
+	file, problems := ParseConfigFile("config.json", []byte(MockProfilesConfig))
+	if file == nil || len(problems) != 0 {
+		t.Fatalf("ParseConfigFile => %v %s", file, problems)
+	}
+	if file.ClientId != "client-0" || file.Get("CacheMaxSeconds") != "600" {
+		t.Errorf("ParseConfigFile settings => %v", file.Settings.Map())
+	}
+	if !StringArraysMatch(SArray("prod", "staging"), ProfileNames(file.Profiles)) {
+		t.Errorf("ParseConfigFile profiles => %v", file.Profiles)
+	}
+
+	_, problems = ParseConfigFile("config.json", []byte(`{"Profiles": {"prod": {"ApiKey": ["a"]}}}`))
+	if err := FirstFatal(problems); err == nil || !strings.Contains(err.Error(), "config.json: Profiles.prod.ApiKey") {
+		t.Errorf("ParseConfigFile with a list setting => %v", problems)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	file, _ := ParseConfigFile("config.json", []byte(MockProfilesConfig))
+	config, profiles := file.Settings, file.Profiles
+
+	res, err := ApplyProfile(config, profiles, "")
+	if err != nil || res.ApiKey != "key-0" {
+		t.Errorf("ApplyProfile('') => %v %v", res.Map(), err)
+	}
+
+	res, err = ApplyProfile(config, profiles, "staging")
+	if err != nil {
+		t.Fatalf("ApplyProfile(staging) => %s", err)
+	}
+	if res.ApiKey != "key-1" || res.DefaultRegion != "ams2" || res.Get("CacheMaxSeconds") != "600" {
+		t.Errorf("ApplyProfile(staging) => %v", res.Map())
+	}
+	if res.CacheDirectory != filepath.Join(DefaultCacheDirectory(), "staging") {
+		t.Errorf("ApplyProfile(staging) should have its own cache directory, got %s", res.CacheDirectory)
+	}
+
+	res, _ = ApplyProfile(config, profiles, "prod")
+	if res.CacheDirectory != "/var/cache/diocean" {
+		t.Errorf("ApplyProfile(prod) => CacheDirectory %s", res.CacheDirectory)
+	}
+
+	_, err = ApplyProfile(config, profiles, "qa")
+	if err == nil || !strings.Contains(err.Error(), "prod, staging") {
+		t.Errorf("ApplyProfile(qa) => %v", err)
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	home, err := ioutil.TempDir("", "diocean-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	savedHome, savedEnv, savedFlag := os.Getenv("HOME"), os.Getenv("DIOCEAN_PROFILE"), CmdlineOptions.Profile
+	defer func() {
+		os.Setenv("HOME", savedHome)
+		os.Setenv("DIOCEAN_PROFILE", savedEnv)
+		CmdlineOptions.Profile = savedFlag
+	}()
+	os.Setenv("HOME", home)
+	os.Setenv("DIOCEAN_PROFILE", "")
+	CmdlineOptions.Profile = ""
+
+	if profile := SelectProfile(); profile != "" {
+		t.Errorf("SelectProfile() with nothing set => %s", profile)
+	}
+
+	EnsureDirectory(filepath.Dir(ProfileStatePath()))
+	ioutil.WriteFile(ProfileStatePath(), []byte("staging\n"), 0644)
+	if profile := SelectProfile(); profile != "staging" {
+		t.Errorf("SelectProfile() with a saved profile => %s", profile)
+	}
+
+	os.Setenv("DIOCEAN_PROFILE", "prod")
+	if profile := SelectProfile(); profile != "prod" {
+		t.Errorf("SelectProfile() with DIOCEAN_PROFILE => %s", profile)
+	}
+
+	CmdlineOptions.Profile = "qa"
+	if profile := SelectProfile(); profile != "qa" {
+		t.Errorf("SelectProfile() with -profile => %s", profile)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Keeping credentials out of diagnostic output: -v dumps, request URLs,
+// error messages and the disk cache.
+
+// Settings whose values are never printed in full: the credentials, as set
+// or as read from their *Command or *File, see ResolveSecrets.
+var SecretSettings = SecretKeys
+
+func IsSecretSetting(key string) bool {
+	for _, secret := range SecretSettings {
+		if key == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactSecret hides all but the last few characters of a secret, enough to
+// tell two keys apart.
+func RedactSecret(value string) string {
+	if len(value) <= 8 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// Query parameters that carry credentials, eg: in the v1 API's URLs.
+var secretParamPattern = regexp.MustCompile(`(?i)\b(api_key|client_id|token)=[^&\s"']*`)
+
+// RedactText replaces the credential query parameters, and any of the
+// configured secrets, in text.
+func RedactText(text string) string {
+	text = secretParamPattern.ReplaceAllString(text, "$1=****")
+	for _, key := range SecretSettings {
+		// very short values would mangle unrelated text
+		if value := Config.Get(key); len(value) >= 4 {
+			text = strings.Replace(text, value, RedactSecret(value), -1)
+		}
+	}
+	return text
+}
+
+// RedactConfig is the settings that are set with the secrets redacted.
+func RedactConfig(config Settings) map[string]string {
+	res := config.Map()
+	for key, value := range res {
+		if IsSecretSetting(key) {
+			res[key] = RedactSecret(value)
+		}
+	}
+	return res
+}
+
+// Debugf prints a diagnostic message, with the secrets redacted, when -v is
+// given.
+func Debugf(format string, args ...interface{}) {
+	if !CmdlineOptions.Verbose {
+		return
+	}
+	fmt.Fprint(os.Stderr, RedactText(fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const MockApiKey = "0123456789abcdefSECRET"
+
+// captureStderr returns whatever fn writes to stderr.
+func captureStderr(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = saved }()
+
+	fn()
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+	return string(out)
+}
+
+func TestRedactText(t *testing.T) {
+	saved := Config
+	Config = MockSettings(t, map[string]string{"ClientId": "client-1", "ApiKey": MockApiKey})
+	defer func() { Config = saved }()
+
+	text := RedactText("GET https://api.digitalocean.com/v1/droplets?api_key=" + MockApiKey + "&client_id=client-1&name=web1 key: " + MockApiKey)
+	if strings.Contains(text, MockApiKey) || strings.Contains(text, "client-1") || !strings.Contains(text, "name=web1") {
+		t.Errorf("RedactText => %s", text)
+	}
+
+	// credentials read from a command or a file are as secret
+	Config, _ = ResolveSecrets(MockSettings(t, map[string]string{"ClientIdCommand": "echo client-from-command", "ApiKeyCommand": "echo " + MockApiKey}))
+	text = RedactText("client: client-from-command key: " + MockApiKey)
+	if strings.Contains(text, "client-from-command") || strings.Contains(text, MockApiKey) {
+		t.Errorf("RedactText with command credentials => %s", text)
+	}
+	if redacted := RedactConfig(Config); redacted["ClientId"] != "****mand" {
+		t.Errorf("RedactConfig => %v", redacted)
+	}
+}
+
+func TestVerboseOutputIsRedacted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "OK", "regions": []}`))
+	}))
+	defer server.Close()
+
+	savedConfig, savedClient, savedUrl, savedVerbose := Config, Client, ApiBaseUrl, CmdlineOptions.Verbose
+	defer func() {
+		Config, Client, ApiBaseUrl, CmdlineOptions.Verbose = savedConfig, savedClient, savedUrl, savedVerbose
+	}()
+	Config = MockSettings(t, map[string]string{"ClientId": "client-1", "ApiKey": MockApiKey, "Token": MockApiKey + "-token"})
+	ApiBaseUrl = server.URL
+	CmdlineOptions.Verbose = true
+	NewClient()
+	if Client.Verbose || Client.ApiKey != MockApiKey {
+		t.Errorf("NewClient should pass the credentials, but not -v, on to the client library")
+	}
+
+	out := captureStderr(t, func() {
+		Debugf("Config: %s\n", RedactConfig(Config))
+		if _, err := ApiCall("/regions", nil); err != nil {
+			t.Errorf("ApiCall(/regions) => %s", err)
+		}
+
+		// the client library's calls are shown too
+		resp, err := http.Get(ApiUrl("/sizes", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		// a failed request names its url in the error
+		ApiBaseUrl = "http://127.0.0.1:1"
+		_, err = ApiCall("/regions", nil)
+		if err == nil {
+			t.Errorf("ApiCall to a closed port should fail")
+		} else {
+			os.Stderr.WriteString(err.Error() + "\n")
+		}
+	})
+
+	t.Logf("verbose output:\n%s", out)
+	if !strings.Contains(out, "ApiCall: GET "+server.URL+"/regions?") || !strings.Contains(out, "ApiCall: GET "+server.URL+"/sizes?") || !strings.Contains(out, "Config:") {
+		t.Errorf("verbose output is missing the diagnostics:\n%s", out)
+	}
+	if strings.Contains(out, MockApiKey) {
+		t.Errorf("verbose output contains the ApiKey:\n%s", out)
+	}
+}
+
+func TestDiskCacheIsRedacted(t *testing.T) {
+	saved := Config
+	Config = MockSettings(t, map[string]string{"ApiKey": MockApiKey})
+	defer func() { Config = saved }()
+
+	body, err := UseDiskCache("RedactTest", 0, func() (interface{}, error) {
+		return map[string]string{"url": "https://api.digitalocean.com/v1/regions?api_key=" + MockApiKey}, nil
+	})
+	if err != nil {
+		t.Fatalf("UseDiskCache => %s", err)
+	}
+	defer RemoveFromDiskCache("RedactTest")
+
+	cacheFile, _ := Config.CacheFilePath("RedactTest.json")
+	cached, _ := ioutil.ReadFile(cacheFile)
+	if len(body) == 0 || strings.Contains(string(cached), MockApiKey) {
+		t.Errorf("UseDiskCache cached %s", cached)
+	}
+}
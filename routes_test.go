@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRouteMatchesOptionalParam(t *testing.T) {
+	InitRoutingTable()
+
+	route := FindMatchingRoute(SArray("droplets", "snapshot", "123"))
+	if route == nil || route.Params["droplet_id"] != "123" || route.Params["name"] != "" {
+		t.Errorf("FindMatchingRoute(droplets snapshot 123) => %v", route)
+	}
+
+	route = FindMatchingRoute(SArray("droplets", "snapshot", "123", "snap1"))
+	if route == nil || route.Params["name"] != "snap1" {
+		t.Errorf("FindMatchingRoute(droplets snapshot 123 snap1) => %v", route)
+	}
+}
+
+func TestRouteMatchesVariadicParam(t *testing.T) {
+	InitRoutingTable()
+
+	route := FindMatchingRoute(SArray("droplets", "reboot", "1", "2", "3"))
+	if route == nil {
+		t.Fatalf("FindMatchingRoute(droplets reboot 1 2 3) found no route")
+	}
+	if values := route.ParamValues("droplet_id"); !StringArraysMatch(SArray("1", "2", "3"), values) {
+		t.Errorf("ParamValues(droplet_id) => %s", values)
+	}
+
+	route = FindMatchingRoute(SArray("droplets", "reboot"))
+	if route != nil {
+		t.Errorf("FindMatchingRoute(droplets reboot) should require a droplet_id, got %v", route)
+	}
+}
+
+func TestRouteMatchesTrailingArgs(t *testing.T) {
+	InitRoutingTable()
+
+	args := SArray("droplets", "show", "123", "456")
+	if route := FindMatchingRoute(args); route != nil {
+		t.Errorf("FindMatchingRoute(%s) should not match, got %v", args, route.Pattern)
+	}
+
+	err := TrailingArgsError(args)
+	if err == nil || !strings.Contains(err.Error(), "456") {
+		t.Errorf("TrailingArgsError(%s) => %v", args, err)
+	}
+}
+
+func TestRoutingTableIsConsistent(t *testing.T) {
+	InitRoutingTable()
+	for _, problem := range CheckRoutingTable(RoutingTable) {
+		t.Errorf("RoutingTable: %s", problem)
+	}
+}
+
+func TestCheckRoutingTable(t *testing.T) {
+	routes := []*Route{
+		NewRoute("images show", DoImageShow, ImageIdParam),
+		NewRoute("images show", DoImageShow, RegionParam),
+		NewRoute("images destroy", DoImageDestroy, Variadic(ImageIdParam), RegionParam),
+	}
+	problems := CheckRoutingTable(routes)
+	if len(problems) != 2 {
+		t.Errorf("CheckRoutingTable => %s", problems)
+	}
+
+	cases := []struct {
+		Left     string
+		Right    string
+		Overlaps bool
+	}{
+		{"x [:a]", "x :a", true},
+		{"x :a...", "x :a :b", true},
+		{"x [:a...]", "x", true},
+		{"x :a [:b]", "x :a :b :c", false},
+		{"x :a", "x :a :b", false},
+		{"x :a", "x y :a", false},
+		{"x :a", "y :a", false},
+	}
+	for _, tc := range cases {
+		_, overlaps := PatternsOverlap(strings.Fields(tc.Left), strings.Fields(tc.Right))
+		problems := CheckRoutingTable([]*Route{{Pattern: strings.Fields(tc.Left)}, {Pattern: strings.Fields(tc.Right)}})
+		if overlaps != tc.Overlaps || (len(problems) > 0) != tc.Overlaps {
+			t.Errorf("PatternsOverlap(%s, %s) => %t, CheckRoutingTable => %s", tc.Left, tc.Right, overlaps, problems)
+		}
+	}
+}
+
+func TestFindMatchingRoutePrefersLiterals(t *testing.T) {
+	InitRoutingTable()
+
+	// a parameter route registered ahead of a literal one must not shadow it
+	RoutingTable = append([]*Route{NewRoute("images", DoImageTransfer, ImageIdParam, RegionParam)}, RoutingTable...)
+	defer InitRoutingTable()
+
+	route := FindMatchingRoute(SArray("images", "show", "123"))
+	if route == nil || !StringArraysMatch(SArray("images", "show", ":image_id"), route.Pattern) {
+		t.Errorf("FindMatchingRoute(images show 123) => %v", route)
+	}
+}
+
+func TestImagesTransferRoute(t *testing.T) {
+	InitRoutingTable()
+
+	route := FindMatchingRoute(SArray("images", "transfer", "3240036", "nyc2", "ams2"))
+	if route == nil {
+		t.Fatalf("FindMatchingRoute(images transfer 3240036 nyc2 ams2) found no route")
+	}
+	if route.Params["image_id"] != "3240036" || !StringArraysMatch(SArray("nyc2", "ams2"), route.ParamValues("region")) {
+		t.Errorf("images transfer params => %v %v", route.Params, route.VarParams)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ranking of matching routes and sanity checks for the RoutingTable.
+
+const (
+	SpecificityVariadic = iota
+	SpecificityOptional
+	SpecificityParam
+	SpecificityLiteral
+)
+
+func PatternPartSpecificity(part string) int {
+	switch {
+	case IsVariadicParam(part):
+		return SpecificityVariadic
+	case IsOptionalParam(part):
+		return SpecificityOptional
+	case IsPatternParam(part):
+		return SpecificityParam
+	}
+	return SpecificityLiteral
+}
+
+// CompareSpecificity compares two patterns part by part, literal words beat
+// parameters, required parameters beat optional ones and those beat variadic
+// ones.  Returns > 0 when left is the more specific.
+func CompareSpecificity(left, right []string) int {
+	for ii := 0; ii < len(left) && ii < len(right); ii++ {
+		diff := PatternPartSpecificity(left[ii]) - PatternPartSpecificity(right[ii])
+		if diff != 0 {
+			return diff
+		}
+	}
+	return len(left) - len(right)
+}
+
+// PatternShape is the pattern with parameter names erased, two routes with
+// the same shape match exactly the same command lines.
+func PatternShape(pattern []string) string {
+	shape := make([]string, len(pattern))
+	for ii, part := range pattern {
+		switch PatternPartSpecificity(part) {
+		case SpecificityVariadic:
+			shape[ii] = ":..."
+		case SpecificityOptional:
+			shape[ii] = "[:]"
+		case SpecificityParam:
+			shape[ii] = ":"
+		default:
+			shape[ii] = part
+		}
+	}
+	return strings.Join(shape, " ")
+}
+
+// CheckRoutingTable reports routes that can never be selected because an
+// earlier route has the same shape, routes that match some of the same
+// command lines as an earlier one, see PatternsOverlap, and patterns that
+// are malformed: a variadic parameter that is not last, or a required part
+// after an optional one.  An alias's problems are reported against its entry
+// in the config file.
+func CheckRoutingTable(routes []*Route) []error {
+	problems := make([]error, 0)
+	report := func(route *Route, err error) {
+		if route.Alias != nil {
+			err = &ConfigError{route.Alias.Path, "Aliases." + route.Alias.Name, err.Error(), false}
+		}
+		problems = append(problems, err)
+	}
+	shapes := make(map[string]*Route)
+	checked := make([]*Route, 0)
+
+	for _, route := range routes {
+		pattern := strings.Join(route.Pattern, " ")
+
+		for ii, part := range route.Pattern {
+			if IsVariadicParam(part) && ii != len(route.Pattern)-1 {
+				report(route, fmt.Errorf("route '%s': variadic parameter %s must be last", pattern, part))
+			}
+			if ii > 0 && IsOptionalParam(route.Pattern[ii-1]) && !IsOptionalParam(part) {
+				report(route, fmt.Errorf("route '%s': %s can not follow optional parameter %s", pattern, part, route.Pattern[ii-1]))
+			}
+		}
+
+		shape := PatternShape(route.Pattern)
+		if other, exists := shapes[shape]; exists {
+			report(route, fmt.Errorf("route '%s' is unreachable, it is ambiguous with the earlier route '%s'", pattern, strings.Join(other.Pattern, " ")))
+			continue
+		}
+		for _, other := range checked {
+			if count, overlaps := PatternsOverlap(other.Pattern, route.Pattern); overlaps {
+				report(route, fmt.Errorf("route '%s' is ambiguous with the earlier route '%s', both match %d arguments after '%s'", pattern, strings.Join(other.Pattern, " "), count, strings.Join(LiteralPrefix(route.Pattern), " ")))
+			}
+		}
+		shapes[shape] = route
+		checked = append(checked, route)
+	}
+
+	return problems
+}
+
+// LiteralPrefix is the words of a pattern before its first parameter.
+func LiteralPrefix(pattern []string) []string {
+	for ii, part := range pattern {
+		if IsPatternParam(part) {
+			return pattern[:ii]
+		}
+	}
+	return pattern
+}
+
+// ArgCountRange is how many words a pattern matches after its literal
+// prefix, max is -1 when there is no limit.
+func ArgCountRange(pattern []string) (min int, max int) {
+	rest := pattern[len(LiteralPrefix(pattern)):]
+	max = len(rest)
+	for _, part := range rest {
+		if IsVariadicParam(part) {
+			max = -1
+		}
+		if !IsOptionalParam(part) {
+			min++
+		}
+	}
+	return min, max
+}
+
+// PatternsOverlap is true when two patterns with the same literal prefix
+// both match the same number of arguments, eg: 'x [:a]' and 'x :a', or
+// 'x :a...' and 'x :a :b'.  The count is the smallest they share.
+func PatternsOverlap(left, right []string) (int, bool) {
+	leftPrefix, rightPrefix := LiteralPrefix(left), LiteralPrefix(right)
+	if strings.Join(leftPrefix, " ") != strings.Join(rightPrefix, " ") {
+		return 0, false
+	}
+
+	leftMin, leftMax := ArgCountRange(left)
+	rightMin, rightMax := ArgCountRange(right)
+	count := leftMin
+	if rightMin > count {
+		count = rightMin
+	}
+	if (leftMax >= 0 && count > leftMax) || (rightMax >= 0 && count > rightMax) {
+		return 0, false
+	}
+	return count, true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Secrets kept out of the config file: any of the credentials may be given
+// as the output of a command or the contents of a file instead, eg:
+//
+//   "ApiKeyCommand": "pass show do/prod"
+//   "ApiKeyFile":    "/run/secrets/do"
+//
+// A plain value, from the config file or the environment, wins over both.
+
+var SecretKeys = []string{"ClientId", "ApiKey", "Token"}
+
+// A secret command that runs longer than this is killed.
+var SecretCommandTimeout = 10 * time.Second
+
+// SecretSettingKeys are the settings that can provide a secret, eg:
+// ApiKey, ApiKeyCommand and ApiKeyFile.
+func SecretSettingKeys(key string) []string {
+	return []string{key, key + "Command", key + "File"}
+}
+
+// ResolveSecrets fills in the credentials given as a command or a file.
+func ResolveSecrets(config Settings) (Settings, error) {
+	res := config
+	for _, key := range SecretKeys {
+		command, file := config.Get(key+"Command"), config.Get(key+"File")
+		if config.IsSet(key) || (command == "" && file == "") {
+			continue
+		}
+
+		if command != "" && file != "" {
+			return Settings{}, fmt.Errorf("%sCommand and %sFile are both set, use only one", key, key)
+		}
+
+		var value string
+		var err error
+		if command != "" {
+			value, err = RunSecretCommand(command)
+			if err != nil {
+				return Settings{}, fmt.Errorf("%sCommand: %w", key, err)
+			}
+		} else {
+			value, err = ReadSecretFile(file)
+			if err != nil {
+				return Settings{}, fmt.Errorf("%sFile: %s", key, err)
+			}
+		}
+		res.Set(key, value)
+	}
+
+	return res, nil
+}
+
+// RunSecretCommand runs a command through the shell and returns its output,
+// without the trailing newline.
+func RunSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SecretCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// don't wait on children of the shell that still hold its output open
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", &ExitError{Code: ExitTimeout, Err: fmt.Errorf("'%s' timed out after %s", command, SecretCommandTimeout)}
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("'%s' failed: %s", command, err)
+		}
+		return "", fmt.Errorf("'%s' failed: %s: %s", command, err, msg)
+	}
+
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", fmt.Errorf("'%s' printed nothing", command)
+	}
+	return value, nil
+}
+
+func ReadSecretFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return value, nil
+}
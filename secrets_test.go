@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diocean-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secretFile := filepath.Join(dir, "do")
+	ioutil.WriteFile(secretFile, []byte("key-from-file\n"), 0600)
+
+	res, err := ResolveSecrets(MockSettings(t, map[string]string{
+		"ClientIdCommand": "echo client-from-command",
+		"ApiKeyFile":      secretFile,
+		"Token":           "token-0",
+		"TokenCommand":    "exit 1",
+	}))
+	if err != nil {
+		t.Fatalf("ResolveSecrets => %s", err)
+	}
+	if res.Get("ClientId") != "client-from-command" || res.Get("ApiKey") != "key-from-file" || res.Get("Token") != "token-0" {
+		t.Errorf("ResolveSecrets => %v", res)
+	}
+
+	_, err = ResolveSecrets(MockSettings(t, map[string]string{"ApiKeyCommand": "echo oops >&2; exit 3"}))
+	if err == nil || !strings.Contains(err.Error(), "ApiKeyCommand") || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("ResolveSecrets with a failing command => %v", err)
+	}
+
+	_, err = ResolveSecrets(MockSettings(t, map[string]string{"ApiKeyCommand": "true"}))
+	if err == nil || !strings.Contains(err.Error(), "printed nothing") {
+		t.Errorf("ResolveSecrets with a silent command => %v", err)
+	}
+
+	_, err = ResolveSecrets(MockSettings(t, map[string]string{"ApiKeyFile": filepath.Join(dir, "missing")}))
+	if err == nil || !strings.Contains(err.Error(), "ApiKeyFile") {
+		t.Errorf("ResolveSecrets with a missing file => %v", err)
+	}
+
+	_, err = ResolveSecrets(MockSettings(t, map[string]string{"ApiKeyFile": secretFile, "ApiKeyCommand": "echo key"}))
+	if err == nil || !strings.Contains(err.Error(), "only one") {
+		t.Errorf("ResolveSecrets with a command and a file => %v", err)
+	}
+}
+
+func TestRunSecretCommandTimeout(t *testing.T) {
+	saved := SecretCommandTimeout
+	SecretCommandTimeout = 100 * time.Millisecond
+	defer func() { SecretCommandTimeout = saved }()
+
+	_, err := RunSecretCommand("sleep 5")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("RunSecretCommand(sleep 5) => %v", err)
+	}
+
+	_, err = ResolveSecrets(MockSettings(t, map[string]string{"ApiKeyCommand": "sleep 5"}))
+	if code := ExitCode(WithExitCode(ExitConfig, err)); code != ExitTimeout {
+		t.Errorf("ResolveSecrets with a slow command => %v, exit code %d", err, code)
+	}
+}
+
+func TestApplyProfileReplacesSecrets(t *testing.T) {
+	config := MockSettings(t, map[string]string{"ClientId": "client-0", "ApiKey": "key-0"})
+	profiles := map[string]Settings{
+		"prod": MockSettings(t, map[string]string{"ApiKeyCommand": "pass show do/prod"}),
+	}
+
+	res, err := ApplyProfile(config, profiles, "prod")
+	if err != nil {
+		t.Fatalf("ApplyProfile(prod) => %s", err)
+	}
+	if res.IsSet("ApiKey") || res.Get("ApiKeyCommand") != "pass show do/prod" || res.Get("ClientId") != "client-0" {
+		t.Errorf("ApplyProfile(prod) => %v", res)
+	}
+}
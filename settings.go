@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The configuration model: the settings of the config file, of each of its
+// profiles and, layered together, the ones in use (Config).  Settings are
+// addressed by their field names, eg: Get("ApiKey"), so the layers can be
+// merged, tracked and checked generically.  Unset settings are "" or nil.
+
+type Settings struct {
+	ClientId                 string `json:",omitempty"`
+	ClientIdCommand          string `json:",omitempty"`
+	ClientIdFile             string `json:",omitempty"`
+	ApiKey                   string `json:",omitempty"`
+	ApiKeyCommand            string `json:",omitempty"`
+	ApiKeyFile               string `json:",omitempty"`
+	Token                    string `json:",omitempty"`
+	TokenCommand             string `json:",omitempty"`
+	TokenFile                string `json:",omitempty"`
+	CacheDirectory           string `json:",omitempty"`
+	CacheMaxSeconds          *int   `json:",omitempty"`
+	DefaultRegion            string `json:",omitempty"`
+	DefaultSize              string `json:",omitempty"`
+	DefaultImage             string `json:",omitempty"`
+	DefaultSshKeyIds         string `json:",omitempty"`
+	DefaultPrivateNetworking *bool  `json:",omitempty"`
+	DefaultBackupsEnabled    *bool  `json:",omitempty"`
+}
+
+// ConfigFile is the contents of a config file: the top level settings, the
+// named profiles and the aliases.
+type ConfigFile struct {
+	Settings
+	Profiles map[string]Settings
+	Aliases  map[string]*Alias
+}
+
+var Config Settings
+
+// SettingKeys are the names of all the settings.
+func SettingKeys() []string {
+	settingsType := reflect.TypeOf(Settings{})
+	keys := make([]string, settingsType.NumField())
+	for ii := range keys {
+		keys[ii] = settingsType.Field(ii).Name
+	}
+	return keys
+}
+
+func IsSettingKey(key string) bool {
+	_, ok := reflect.TypeOf(Settings{}).FieldByName(key)
+	return ok
+}
+
+// Get returns a setting as text, "" when it is not set.
+func (self *Settings) Get(key string) string {
+	field := reflect.ValueOf(self).Elem().FieldByName(key)
+	if !field.IsValid() {
+		return ""
+	}
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return ""
+		}
+		field = field.Elem()
+	}
+	return fmt.Sprintf("%v", field.Interface())
+}
+
+// Set parses text into a setting, "" unsets it.
+func (self *Settings) Set(key, value string) error {
+	field := reflect.ValueOf(self).Elem().FieldByName(key)
+	if !field.IsValid() {
+		return fmt.Errorf("unknown setting")
+	}
+
+	if value == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	switch field.Type() {
+	case reflect.TypeOf(""):
+		field.SetString(value)
+	case reflect.TypeOf((*int)(nil)):
+		ii, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got '%s'", value)
+		}
+		field.Set(reflect.ValueOf(&ii))
+	case reflect.TypeOf((*bool)(nil)):
+		bb, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got '%s'", value)
+		}
+		field.Set(reflect.ValueOf(&bb))
+	}
+	return nil
+}
+
+// SetValue sets a setting from a value read from a config file: a string,
+// number or boolean.  Numbers and booleans may also be given as strings, as
+// older JSON config files do, eg: "CacheMaxSeconds": "600"
+func (self *Settings) SetValue(key string, value interface{}) error {
+	switch val := value.(type) {
+	case string:
+		return self.Set(key, val)
+	case bool:
+		return self.Set(key, strconv.FormatBool(val))
+	case int64:
+		return self.Set(key, strconv.FormatInt(val, 10))
+	case float64:
+		if val != math.Trunc(val) {
+			return fmt.Errorf("expected an integer, got %v", val)
+		}
+		return self.Set(key, strconv.FormatFloat(val, 'f', -1, 64))
+	case nil:
+		return self.Set(key, "")
+	}
+	return fmt.Errorf("expected a string, number or boolean, got %v", value)
+}
+
+// Overlay returns the settings with those set in other on top.
+func (self Settings) Overlay(other Settings) Settings {
+	res := self
+	for _, key := range SettingKeys() {
+		if other.IsSet(key) {
+			reflect.ValueOf(&res).Elem().FieldByName(key).Set(reflect.ValueOf(other).FieldByName(key))
+		}
+	}
+	return res
+}
+
+func (self Settings) IsSet(key string) bool {
+	return self.Get(key) != ""
+}
+
+// Map is the settings that are set, as text.
+func (self Settings) Map() map[string]string {
+	res := make(map[string]string)
+	for _, key := range SettingKeys() {
+		if value := self.Get(key); value != "" {
+			res[key] = value
+		}
+	}
+	return res
+}
+
+// SettingSpec is the route option a Default... setting provides the value
+// of, eg: DefaultSize for --size.  Its type checks the setting's value.
+func SettingSpec(key string) *ParamSpec {
+	for _, route := range RoutingTable {
+		for _, spec := range route.Options {
+			if spec.ConfigKey() == key {
+				return spec
+			}
+		}
+	}
+	return nil
+}
+
+// ConfigError is a problem with a config file, eg: a value of the wrong
+// type, along with the file and the key it is about.  Problems that are not
+// Fatal, eg: unknown settings, are only reported by 'config validate'.
+type ConfigError struct {
+	Path  string
+	Key   string
+	Msg   string
+	Fatal bool
+}
+
+func (self *ConfigError) Error() string {
+	if self.Key == "" {
+		return fmt.Sprintf("%s: %s", self.Path, self.Msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", self.Path, self.Key, self.Msg)
+}
+
+// FirstFatal returns the first problem that stops the config from being
+// used, nil when there is none.
+func FirstFatal(problems []error) error {
+	for _, problem := range problems {
+		if cerr, ok := problem.(*ConfigError); !ok || cerr.Fatal {
+			return problem
+		}
+	}
+	return nil
+}
+
+// ConfigFormat picks the format of a config file from its extension, JSON
+// unless it is .yaml, .yml or .toml
+func ConfigFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "json"
+}
+
+// ReadConfigFile reads and decodes a config file, returning every problem
+// found with it.
+func ReadConfigFile(path string) (*ConfigFile, []error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return ParseConfigFile(path, content)
+}
+
+func ParseConfigFile(path string, content []byte) (*ConfigFile, []error) {
+	var raw map[string]interface{}
+	var err error
+	switch ConfigFormat(path) {
+	case "yaml":
+		raw, err = ReadYaml(content)
+	case "toml":
+		raw, err = ReadToml(content)
+	default:
+		err = json.Unmarshal(content, &raw)
+	}
+	if err != nil {
+		return nil, []error{&ConfigError{Path: path, Msg: err.Error(), Fatal: true}}
+	}
+
+	return DecodeConfigFile(path, raw)
+}
+
+// DecodeConfigFile fills in a ConfigFile from the parsed contents of a
+// config file.
+func DecodeConfigFile(path string, raw map[string]interface{}) (*ConfigFile, []error) {
+	res := &ConfigFile{Profiles: make(map[string]Settings), Aliases: make(map[string]*Alias)}
+	problems := DecodeSettings(path, "", raw, &res.Settings)
+	problems = append(problems, DecodeAliases(path, raw, res.Aliases)...)
+
+	profiles, ok := raw["Profiles"]
+	if !ok {
+		return res, problems
+	}
+	profileMap, ok := profiles.(map[string]interface{})
+	if !ok {
+		return res, append(problems, &ConfigError{path, "Profiles", "expected a table of profiles", true})
+	}
+
+	for _, name := range sortedKeys(profileMap) {
+		context := "Profiles." + name
+		settings, ok := profileMap[name].(map[string]interface{})
+		if !ok {
+			problems = append(problems, &ConfigError{path, context, "expected a table of settings", true})
+			continue
+		}
+		var profile Settings
+		problems = append(problems, DecodeSettings(path, context, settings, &profile)...)
+		res.Profiles[name] = profile
+	}
+
+	return res, problems
+}
+
+// DecodeSettings sets the settings from raw, reporting each key that is
+// unknown, of the wrong type or not a valid value for the route option it
+// provides the default of.
+func DecodeSettings(path, context string, raw map[string]interface{}, settings *Settings) []error {
+	problems := make([]error, 0)
+	for _, key := range sortedKeys(raw) {
+		name := key
+		if context != "" {
+			name = context + "." + key
+		}
+
+		if (key == "Profiles" || key == "Aliases") && context == "" {
+			continue
+		}
+		if !IsSettingKey(key) {
+			problems = append(problems, &ConfigError{path, name, "unknown setting", false})
+			continue
+		}
+
+		if err := settings.SetValue(key, raw[key]); err != nil {
+			problems = append(problems, &ConfigError{path, name, err.Error(), true})
+			continue
+		}
+
+		value := settings.Get(key)
+		if spec := SettingSpec(key); spec != nil && value != "" {
+			if expected := spec.Type.Expected(value); expected != "" {
+				problems = append(problems, &ConfigError{path, name, fmt.Sprintf("invalid value '%s', expected %s", value, expected), false})
+			}
+		}
+	}
+	return problems
+}
+
+func sortedKeys(raw map[string]interface{}) []string {
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DefaultConfigPath is the first of ~/.digitalocean.json, .yaml, .yml or
+// .toml that exists, ~/.digitalocean.json when there are none.
+func DefaultConfigPath(home string) string {
+	base := filepath.Join(home, ".digitalocean")
+	for _, ext := range []string{".json", ".yaml", ".yml", ".toml"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return base + ".json"
+}
+
+// FormatConfigFile writes settings in the format of the path's extension.
+func FormatConfigFile(path string, settings Settings) ([]byte, error) {
+	format := ConfigFormat(path)
+	if format == "json" {
+		content, err := json.MarshalIndent(settings, "", "  ")
+		return append(content, '\n'), err
+	}
+
+	var buf bytes.Buffer
+	settingsType := reflect.TypeOf(settings)
+	for _, key := range SettingKeys() {
+		value := settings.Get(key)
+		if value == "" {
+			continue
+		}
+		if field, _ := settingsType.FieldByName(key); field.Type.Kind() == reflect.String {
+			quoted, _ := json.Marshal(value)
+			value = string(quoted)
+		}
+		if format == "toml" {
+			fmt.Fprintf(&buf, "%s = %s\n", key, value)
+		} else {
+			fmt.Fprintf(&buf, "%s: %s\n", key, value)
+		}
+	}
+	return buf.Bytes(), nil
+}
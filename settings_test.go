@@ -0,0 +1,146 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// MockSettings builds Settings from their text values.
+func MockSettings(t *testing.T, values map[string]string) Settings {
+	var settings Settings
+	for key, value := range values {
+		if err := settings.Set(key, value); err != nil {
+			t.Fatalf("MockSettings: %s: %s", key, err)
+		}
+	}
+	return settings
+}
+
+func TestSettingsSetAndOverlay(t *testing.T) {
+	base := MockSettings(t, map[string]string{"ClientId": "c", "CacheMaxSeconds": "600", "DefaultPrivateNetworking": "true"})
+	top := MockSettings(t, map[string]string{"CacheMaxSeconds": "0", "DefaultPrivateNetworking": "false"})
+
+	res := base.Overlay(top)
+	if res.ClientId != "c" || *res.CacheMaxSeconds != 0 || *res.DefaultPrivateNetworking {
+		t.Errorf("Overlay => %v", res.Map())
+	}
+	if *base.CacheMaxSeconds != 600 {
+		t.Errorf("Overlay modified its receiver: %v", base.Map())
+	}
+
+	var settings Settings
+	if err := settings.Set("CacheMaxSeconds", "soon"); err == nil || !strings.Contains(err.Error(), "expected an integer") {
+		t.Errorf("Set(CacheMaxSeconds, soon) => %v", err)
+	}
+	if err := settings.Set("Foo", "1"); err == nil {
+		t.Errorf("Set(Foo) should fail")
+	}
+}
+
+var MockJsonConfig = `{
+  "ClientId": "c",
+  "ApiKey": "k",
+  "CacheMaxSeconds": "600",
+  "Profiles": {"prod": {"DefaultRegion": "nyc2", "DefaultBackupsEnabled": true, "CacheMaxSeconds": 60}}
+}`
+
+var MockYamlConfig = `# diocean
+ClientId: c
+ApiKey: "k"
+CacheMaxSeconds: 600
+Profiles:
+  prod:
+    DefaultRegion: nyc2   # new york
+    DefaultBackupsEnabled: true
+    CacheMaxSeconds: 60
+`
+
+var MockTomlConfig = `# diocean
+ClientId = "c"
+ApiKey = 'k'
+CacheMaxSeconds = 600
+
+[Profiles.prod]
+DefaultRegion = "nyc2" # new york
+DefaultBackupsEnabled = true
+CacheMaxSeconds = 60
+`
+
+func TestParseConfigFileFormats(t *testing.T) {
+	InitRoutingTable()
+	for path, content := range map[string]string{
+		"config.json": MockJsonConfig,
+		"config.yaml": MockYamlConfig,
+		"config.toml": MockTomlConfig,
+	} {
+		file, problems := ParseConfigFile(path, []byte(content))
+		if file == nil || len(problems) != 0 {
+			t.Errorf("ParseConfigFile(%s) => %s", path, problems)
+			continue
+		}
+
+		prod := file.Profiles["prod"]
+		if file.ClientId != "c" || file.ApiKey != "k" || *file.CacheMaxSeconds != 600 {
+			t.Errorf("ParseConfigFile(%s) settings => %v", path, file.Settings.Map())
+		}
+		if prod.DefaultRegion != "nyc2" || !*prod.DefaultBackupsEnabled || *prod.CacheMaxSeconds != 60 {
+			t.Errorf("ParseConfigFile(%s) prod => %v", path, prod.Map())
+		}
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	InitRoutingTable()
+	cases := []struct {
+		Path     string
+		Content  string
+		Expected string
+		Fatal    bool
+	}{
+		{"config.json", `{"CacheMaxSeconds": "soon"}`, "config.json: CacheMaxSeconds: expected an integer, got 'soon'", true},
+		{"config.json", `{"CacheMaxSeconds": 1.5}`, "config.json: CacheMaxSeconds: expected an integer", true},
+		{"config.json", `{"Foo": "1"}`, "config.json: Foo: unknown setting", false},
+		{"config.json", `{"DefaultSize": "1 GB"}`, "config.json: DefaultSize: invalid value '1 GB'", false},
+		{"config.yaml", "Profiles:\n  prod:\n    DefaultPrivateNetworking: maybe\n", "config.yaml: Profiles.prod.DefaultPrivateNetworking: expected true or false", true},
+		{"config.yaml", "ClientId: c\n  ApiKey: k\n", "config.yaml: line 2: unexpected indentation", true},
+		{"config.yaml", "Profiles:\n  - prod\n", "config.yaml: line 2: lists are not supported", true},
+		{"config.toml", "[Profiles.prod]\nCacheMaxSeconds = \"soon\"\n", "config.toml: Profiles.prod.CacheMaxSeconds: expected an integer", true},
+		{"config.toml", "ClientId = c\n", "config.toml: line 1: invalid value 'c', strings must be quoted", true},
+		{"config.toml", "ClientId = \"c\"\nClientId = \"d\"\n", "config.toml: line 2: duplicate key 'ClientId'", true},
+	}
+
+	for _, tc := range cases {
+		_, problems := ParseConfigFile(tc.Path, []byte(tc.Content))
+		if len(problems) != 1 || !strings.HasPrefix(problems[0].Error(), tc.Expected) {
+			t.Errorf("ParseConfigFile(%s, %q) => %s, expected %s", tc.Path, tc.Content, problems, tc.Expected)
+			continue
+		}
+		if fatal := FirstFatal(problems) != nil; fatal != tc.Fatal {
+			t.Errorf("ParseConfigFile(%s, %q) fatal => %v", tc.Path, tc.Content, fatal)
+		}
+	}
+}
+
+func TestFormatConfigFile(t *testing.T) {
+	settings := MockSettings(t, map[string]string{
+		"ClientId":                 "client \"0\"",
+		"CacheMaxSeconds":          "600",
+		"DefaultPrivateNetworking": "true",
+	})
+
+	for _, path := range []string{"config.json", "config.yaml", "config.toml"} {
+		content, err := FormatConfigFile(path, settings)
+		if err != nil {
+			t.Fatalf("FormatConfigFile(%s) => %s", path, err)
+		}
+		file, problems := ParseConfigFile(path, content)
+		if len(problems) > 0 {
+			t.Errorf("ParseConfigFile(%s, %q) => %s", path, content, problems)
+			continue
+		}
+		if !reflect.DeepEqual(file.Settings, settings) {
+			t.Errorf("ParseConfigFile(%s, %q) => %v, expected %v", path, content, file.Settings, settings)
+		}
+	}
+}
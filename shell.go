@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 'diocean shell': runs commands one line at a time with the config loaded
+// once, eg:
+//
+//   diocean> droplets ls --filter status=active
+//   diocean> -w droplets reboot 123456
+//
+// Each line takes the same flags as the command line, for that line only.
+// Responses used for completion stay in MemoryCache between commands, the
+// list commands refresh them, see ListCall.
+
+// InShell is set while 'diocean shell' runs.
+var InShell bool
+
+// CommandContext is cancelled when the running command is interrupted, the
+// calls to the API are made with it.
+var CommandContext = context.Background()
+
+var interruptLock sync.Mutex
+var interruptFn func()
+
+// Interrupt handles ^C: the shell's running line is cancelled, anything
+// else exits.
+func Interrupt() {
+	interruptLock.Lock()
+	fn := interruptFn
+	interruptLock.Unlock()
+	if fn == nil {
+		Fail(CancelledError("interrupted"))
+	}
+	fn()
+}
+
+// OnInterrupt has Interrupt call fn rather than exit, the returned func
+// puts it back.
+func OnInterrupt(fn func()) func() {
+	interruptLock.Lock()
+	defer interruptLock.Unlock()
+	saved := interruptFn
+	interruptFn = fn
+	return func() {
+		interruptLock.Lock()
+		defer interruptLock.Unlock()
+		interruptFn = saved
+	}
+}
+
+// At most this many lines are kept in the history file.
+var ShellHistorySize = 500
+
+func ShellHistoryPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".digitalocean", "shell_history")
+}
+
+type Shell struct {
+	*LineRunner
+	In *bufio.Reader
+	// the line editor on a terminal, otherwise lines are read as they are
+	Editor  *LineEditor
+	History []string
+}
+
+func NewShell(in io.Reader) *Shell {
+	return &Shell{
+		LineRunner: NewLineRunner("shell"),
+		In:         bufio.NewReader(in),
+		History:    ReadShellHistory(ShellHistoryPath()),
+	}
+}
+
+func DoShell(route *Route) error {
+	shell := NewShell(os.Stdin)
+	if IsTerminal(os.Stdin) {
+		shell.Editor = &LineEditor{
+			In:       shell.In,
+			Out:      os.Stdout,
+			Prompt:   "diocean> ",
+			Complete: shell.Complete,
+		}
+	}
+	return shell.Run()
+}
+
+// Run reads and runs commands until 'exit' or the end of the input.
+// Errors are reported and the shell carries on.
+func (self *Shell) Run() error {
+	defer self.Begin()()
+	InShell = true
+	defer func() { InShell = false }()
+
+	for {
+		line, err := self.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if self.Editor != nil {
+			self.AddHistory(line)
+		}
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+
+		if err := self.RunInterruptible(line); err != nil {
+			ReportError(os.Stderr, err)
+		}
+	}
+}
+
+// RunInterruptible runs a line that ^C cancels, back to the prompt rather
+// than out of the shell.
+func (self *Shell) RunInterruptible(line string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	CommandContext = ctx
+	defer func() { CommandContext = context.Background() }()
+	defer OnInterrupt(cancel)()
+
+	err := self.RunLine(line)
+	if ctx.Err() != nil {
+		return CancelledError("interrupted")
+	}
+	return err
+}
+
+func (self *Shell) ReadLine() (string, error) {
+	if self.Editor != nil {
+		self.Editor.History = self.History
+		return self.Editor.ReadLine()
+	}
+
+	line, err := self.In.ReadString('\n')
+	if err == io.EOF && line != "" {
+		return line, nil
+	}
+	return line, err
+}
+
+// LineRunner runs commands given as lines of text, for 'diocean shell' and
+// 'diocean batch'.  Each line takes the same flags as the command line, for
+// that line only.
+type LineRunner struct {
+	Flags *flag.FlagSet
+	// commands that can't be run from a line, eg: 'shell' from the shell
+	Disallowed []string
+	// the config is reloaded before the next line, eg: after 'profile use'
+	configStale bool
+	restore     func()
+}
+
+func NewLineRunner(disallowed ...string) *LineRunner {
+	// the route options of the command that runs the lines, eg: batch
+	// --keep-going, are not for the lines
+	routeOptions := CmdlineOptions.RouteOptions
+	CmdlineOptions.RouteOptions = nil
+	defer func() { CmdlineOptions.RouteOptions = routeOptions }()
+
+	return &LineRunner{
+		Flags:      flag.CommandLine,
+		Disallowed: disallowed,
+		restore:    SaveOptions(),
+	}
+}
+
+// Begin has a bad flag on a line reported, without the usage, rather than
+// exiting.  The returned func puts the flags back as they were.
+func (self *LineRunner) Begin() func() {
+	errorHandling, output := self.Flags.ErrorHandling(), self.Flags.Output()
+	self.Flags.Init(self.Flags.Name(), flag.ContinueOnError)
+	self.Flags.SetOutput(ioutil.Discard)
+	return func() {
+		self.Flags.Init(self.Flags.Name(), errorHandling)
+		self.Flags.SetOutput(output)
+	}
+}
+
+// RunLine runs one command, its flags only apply to it.
+func (self *LineRunner) RunLine(line string) error {
+	args, err := SplitCommandLine(line)
+	if err != nil {
+		return WithExitCode(ExitUsage, err)
+	}
+
+	// the line starts from the snapshot, not the options of whatever runs it
+	self.restore()
+	defer self.restore()
+	profile, configPath := CmdlineOptions.Profile, CmdlineOptions.ConfigPath
+	args, err = ParseCommandLine(self.Flags, args)
+	if err != nil {
+		return WithExitCode(ExitUsage, err)
+	}
+
+	route := FindMatchingRoute(args)
+	if route != nil && StringArrayContains(self.Disallowed, route.Pattern[0]) {
+		return UsageError("'%s' can not be run from here", route.Pattern[0])
+	}
+
+	// with -profile or -c the line has a config of its own, the next one
+	// goes back to the shell's
+	lineConfig := profile != CmdlineOptions.Profile || configPath != CmdlineOptions.ConfigPath
+	if self.configStale || lineConfig {
+		err := LoadConfig()
+		self.configStale = lineConfig
+		if err != nil && !OwnsConfig(route, args) {
+			self.configStale = true
+			return WithExitCode(ExitConfig, err)
+		}
+	}
+	NewClient()
+
+	err = RunRoute(route, args)
+	// eg: 'profile use' or 'config init' changed what the next line reads
+	if route != nil && route.Offline {
+		self.configStale = true
+	}
+	return err
+}
+
+// Complete is the shell's tab completion: the candidates for the word
+// before the cursor, from the same engine as the bash completion.
+func (self *Shell) Complete(before string) (string, []string) {
+	args, err := SplitCommandLine(before)
+	if err != nil {
+		return before, nil
+	}
+	word := ""
+	if len(args) > 0 && !strings.HasSuffix(before, " ") {
+		word = args[len(args)-1]
+	}
+
+	defer self.restore()
+	words, err := CompletionWords(args)
+	if err != nil {
+		return before, nil
+	}
+
+	cands := make([]string, 0)
+	for _, cand := range words {
+		if strings.HasPrefix(cand, word) && !IsPatternParam(cand) {
+			cands = AppendUnique(cands, cand)
+		}
+	}
+
+	prefix := strings.TrimSuffix(before, word)
+	switch len(cands) {
+	case 0:
+		return before, nil
+	case 1:
+		return prefix + cands[0] + " ", nil
+	}
+	return prefix + CommonPrefix(cands), cands
+}
+
+func CommonPrefix(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+func (self *Shell) AddHistory(line string) {
+	if len(self.History) > 0 && self.History[len(self.History)-1] == line {
+		return
+	}
+	self.History = append(self.History, line)
+	if len(self.History) > ShellHistorySize {
+		self.History = self.History[len(self.History)-ShellHistorySize:]
+	}
+
+	path := ShellHistoryPath()
+	if err := EnsureDirectory(filepath.Dir(path)); err != nil {
+		Debugf("shell history: %s\n", err)
+		return
+	}
+	content := strings.Join(self.History, "\n") + "\n"
+	// commands may name secrets, eg: a template printing a key
+	if err := ioutil.WriteFile(path, []byte(RedactText(content)), 0600); err != nil {
+		Debugf("shell history: %s\n", err)
+	}
+}
+
+func ReadShellHistory(path string) []string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{}
+	}
+	history := make([]string, 0)
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			history = append(history, line)
+		}
+	}
+	return history
+}
+
+// SaveOptions snapshots the global flags, the returned func puts them back,
+// eg: after each line of 'diocean shell'.
+func SaveOptions() func() {
+	saved := copyOptions(CmdlineOptions)
+	savedTimeout := EventWaitTimeout
+	return func() {
+		CmdlineOptions = copyOptions(saved)
+		EventWaitTimeout = savedTimeout
+	}
+}
+
+func copyOptions(options CmdlineOptionsStruct) CmdlineOptionsStruct {
+	res := options
+	res.Filters = append(StringListFlag(nil), options.Filters...)
+	res.RouteOptions = make(map[string]string)
+	for name, value := range options.RouteOptions {
+		res.RouteOptions[name] = value
+	}
+	return res
+}
+
+// SplitCommandLine splits a line into words the way a shell would, with
+// single and double quotes and backslash escapes, eg:
+//
+//   -o template='{{.Name}} {{.Status}}' droplets ls
+//
+// A '#' at the start of a word comments out the rest of the line.
+func SplitCommandLine(line string) ([]string, error) {
+	words := make([]string, 0)
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for ii := 0; ii < len(runes); ii++ {
+		r := runes[ii]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && ii+1 < len(runes) && strings.ContainsRune(`"\$`, runes[ii+1]) {
+				ii++
+				word.WriteRune(runes[ii])
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if ii+1 < len(runes) {
+				ii++
+				word.WriteRune(runes[ii])
+			}
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '#' && !inWord:
+			ii = len(runes)
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
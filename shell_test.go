@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	cases := []struct {
+		Line     string
+		Expected []string
+	}{
+		{"droplets ls", SArray("droplets", "ls")},
+		{"  droplets   ls\t", SArray("droplets", "ls")},
+		{"-o template='{{.Name}} {{.Status}}' droplets ls", SArray("-o", "template={{.Name}} {{.Status}}", "droplets", "ls")},
+		{`droplets new "web \"1\"" a\ b`, SArray("droplets", "new", `web "1"`, "a b")},
+		{`droplets new ''`, SArray("droplets", "new", "")},
+		{"droplets ls # the active ones", SArray("droplets", "ls")},
+		{"droplets new web#1", SArray("droplets", "new", "web#1")},
+		{"", SArray()},
+	}
+
+	for _, tc := range cases {
+		words, err := SplitCommandLine(tc.Line)
+		if err != nil || !StringArraysMatch(tc.Expected, words) {
+			t.Errorf("SplitCommandLine(%q) => %q, %v, expected %q", tc.Line, words, err, tc.Expected)
+		}
+	}
+
+	if _, err := SplitCommandLine("droplets new 'web1"); err == nil {
+		t.Errorf("SplitCommandLine with an unterminated quote should fail")
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	InitRoutingTable()
+	shell := NewShell(strings.NewReader(""))
+
+	cases := []struct {
+		Before   string
+		Expected string
+		Cands    []string
+	}{
+		{"drop", "droplets ", nil},
+		{"droplets sh", "droplets sh", SArray("show", "shut-down", "shutdown")},
+		{"droplets power-o", "droplets power-o", SArray("power-off", "power-on")},
+		{"droplets new web1 --private-n", "droplets new web1 --private-networking ", nil},
+		{"frob", "frob", nil},
+	}
+
+	for _, tc := range cases {
+		line, cands := shell.Complete(tc.Before)
+		if line != tc.Expected || !StringArraysMatch(tc.Cands, cands) {
+			t.Errorf("Complete(%q) => %q %q, expected %q %q", tc.Before, line, cands, tc.Expected, tc.Cands)
+		}
+	}
+}
+
+func TestShellRun(t *testing.T) {
+	InitRoutingTable()
+	savedConfig, savedOptions := Config, CmdlineOptions
+	defer func() { Config, CmdlineOptions = savedConfig, savedOptions }()
+	Config = MockSettings(t, map[string]string{"ClientId": "client-1", "ApiKey": "key-1"})
+	CmdlineOptions.Output = OutputText
+
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	flags.BoolVar(&CmdlineOptions.DryRun, "dry-run", false, "")
+	RegisterRouteOptions(flags)
+
+	shell := NewShell(strings.NewReader(`
+# comments and blank lines are skipped
+-dry-run droplets new web1 --size 1gb --region nyc2 --image ubuntu
+droplets frob
+-bogus droplets ls
+exit
+droplets ls
+`))
+	shell.Flags = flags
+
+	var err error
+	out := captureStderr(t, func() { err = shell.Run() })
+	if err != nil {
+		t.Fatalf("Shell.Run => %s", err)
+	}
+
+	if !strings.Contains(out, "unrecognized command: droplets frob") || !strings.Contains(out, "flag provided but not defined: -bogus") {
+		t.Errorf("Shell.Run errors => %s", out)
+	}
+	if strings.Count(out, "Error:") != 2 {
+		t.Errorf("Shell.Run should stop at exit => %s", out)
+	}
+	if CmdlineOptions.DryRun || len(CmdlineOptions.RouteOptions) > 0 {
+		t.Errorf("Shell.Run left the options of a line set: %+v", CmdlineOptions)
+	}
+}
+
+func TestShellInterrupt(t *testing.T) {
+	InitRoutingTable()
+	savedConfig, savedOptions, savedUrl := Config, CmdlineOptions, ApiBaseUrl
+	defer func() { Config, CmdlineOptions, ApiBaseUrl = savedConfig, savedOptions, savedUrl }()
+	Config = MockSettings(t, map[string]string{"ClientId": "client-1", "ApiKey": "key-1"})
+	CmdlineOptions.Output = OutputJson
+
+	// the first call hangs until it is cancelled, the rest answer
+	called := make(chan bool, 1)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			called <- true
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(`{"status": "OK", "event_id": 7}`))
+	}))
+	defer server.Close()
+	ApiBaseUrl = server.URL
+
+	go func() {
+		<-called
+		Interrupt()
+	}()
+
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	flags.BoolVar(&CmdlineOptions.Quiet, "q", false, "")
+	shell := NewShell(strings.NewReader("droplets reboot 123\n-q droplets reboot 456\n"))
+	shell.Flags = flags
+	var err error
+	errOut := ""
+	out := captureStdout(t, func() {
+		errOut = captureStderr(t, func() { err = shell.Run() })
+	})
+	if err != nil || errOut != "Error: interrupted\n" || out != "7\n" {
+		t.Errorf("Shell.Run with ^C => %v, printed %q, %q", err, out, errOut)
+	}
+}
+
+func TestShellListWarmsCache(t *testing.T) {
+	InitRoutingTable()
+	savedConfig := Config
+	defer func() { Config = savedConfig }()
+	Config = MockSettings(t, map[string]string{"ClientId": "client-1", "ApiKey": "key-1"})
+	cacheFile, err := Config.CacheFilePath("DropletsLs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RemoveFromDiskCache("DropletsLs")
+	defer RemoveFromDiskCache("DropletsLs")
+
+	withApi(t, `{"status": "OK", "event_id": 7, "droplets": [{"id": 123, "name": "web1"}]}`, func() {
+		CmdlineOptions.Output = OutputTable
+		flags := flag.NewFlagSet("test", flag.ExitOnError)
+		run := func(lines string) {
+			shell := NewShell(strings.NewReader(lines))
+			shell.Flags = flags
+			captureStdout(t, func() {
+				if err := shell.Run(); err != nil {
+					t.Errorf("Shell.Run(%q) => %s", lines, err)
+				}
+			})
+		}
+
+		run("droplets ls\n")
+		if _, ok := MemoryCache[cacheFile]; !ok {
+			t.Errorf("droplets ls in the shell should have cached the droplets")
+		}
+		if words := ParameterCompletions(nil, ":droplet_name", ""); !StringArraysMatch(SArray("web1"), words) {
+			t.Errorf("ParameterCompletions(:droplet_name) after droplets ls => %s", words)
+		}
+
+		run("droplets destroy 123\n")
+		if _, ok := MemoryCache[cacheFile]; ok {
+			t.Errorf("droplets destroy should have dropped the cached droplets")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diagnostics for command lines that did not match any route.
+
+// At most this many edits per word are allowed for a 'did you mean'
+// suggestion.
+var SuggestMaxDistance = 2
+
+// EditDistance is the Levenshtein distance between two words.
+func EditDistance(left, right string) int {
+	a := []rune(left)
+	b := []rune(right)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for jj := range prev {
+		prev[jj] = jj
+	}
+
+	for ii := 1; ii <= len(a); ii++ {
+		curr[0] = ii
+		for jj := 1; jj <= len(b); jj++ {
+			cost := 1
+			if a[ii-1] == b[jj-1] {
+				cost = 0
+			}
+			curr[jj] = minInt(minInt(prev[jj]+1, curr[jj-1]+1), prev[jj-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// WordDistance scores how close a typed word is to a command word: 0 for
+// an exact match or an unambiguous start of the word (eg: 'dr' for
+// 'droplets'), otherwise the edit distance.
+func WordDistance(typed, word string) int {
+	if typed == word || (len(typed) > 1 && strings.HasPrefix(word, typed)) {
+		return 0
+	}
+	return EditDistance(typed, word)
+}
+
+type commandSuggestion struct {
+	Command  string
+	Distance int
+}
+
+// SuggestCommands returns the commands the args were most likely meant to
+// be, closest first, eg: 'droplet ls' => 'droplets ls'
+func SuggestCommands(args []string) []string {
+	suggestions := make([]commandSuggestion, 0)
+	seen := make(map[string]bool)
+
+	for _, route := range RoutingTable {
+		cmd := route.CommandWords()
+		if len(args) < len(cmd) {
+			cmd = cmd[:len(args)]
+		}
+		if len(cmd) == 0 {
+			continue
+		}
+
+		total := 0
+		for ii, word := range cmd {
+			dist := WordDistance(args[ii], word)
+			if dist > SuggestMaxDistance {
+				total = -1
+				break
+			}
+			total += dist
+		}
+
+		command := strings.Join(cmd, " ")
+		if total < 0 || seen[command] {
+			continue
+		}
+		seen[command] = true
+		suggestions = append(suggestions, commandSuggestion{command, total})
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Distance < suggestions[j].Distance
+	})
+
+	res := make([]string, 0)
+	for _, suggestion := range suggestions {
+		if len(res) == 3 {
+			break
+		}
+		res = append(res, suggestion.Command)
+	}
+	return res
+}
+
+// MissingParamError explains a failed match where the command words of a
+// route were given but not enough of its parameters, naming the first
+// parameter that is missing.
+func MissingParamError(args []string) error {
+	for _, route := range RoutingTable {
+		cmd := route.CommandWords()
+		if len(args) < len(cmd) || !StringArraysEqual(args[:len(cmd)], cmd) {
+			continue
+		}
+
+		if len(args) >= len(route.Pattern) {
+			continue
+		}
+
+		part := route.Pattern[len(args)]
+		if IsOptionalParam(part) {
+			continue
+		}
+
+		name := PatternParamName(part)
+		description := ""
+		if spec := route.ParamSpec(name); spec != nil {
+			description = " (" + spec.Description + ")"
+		}
+		return fmt.Errorf("%s: missing required parameter :%s%s\nUsage: diocean %s",
+			strings.Join(cmd, " "), name, description, strings.Join(route.Pattern, " "))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	cases := map[[2]string]int{
+		{"droplet", "droplets"}:  1,
+		{"dropletz", "droplets"}: 1,
+		{"ls", "ls"}:             0,
+		{"", "ls"}:               2,
+		{"reboot", "rebot"}:      1,
+	}
+	for words, expected := range cases {
+		if dist := EditDistance(words[0], words[1]); dist != expected {
+			t.Errorf("EditDistance(%s, %s) => %d != %d", words[0], words[1], dist, expected)
+		}
+	}
+}
+
+func TestSuggestCommands(t *testing.T) {
+	InitRoutingTable()
+
+	suggestions := SuggestCommands(SArray("droplet", "ls"))
+	if len(suggestions) == 0 || suggestions[0] != "droplets ls" {
+		t.Errorf("SuggestCommands(droplet ls) => %s", suggestions)
+	}
+
+	suggestions = SuggestCommands(SArray("images", "rm", "123"))
+	if !StringArrayContains(suggestions, "images ls") {
+		t.Errorf("SuggestCommands(images rm 123) => %s", suggestions)
+	}
+
+	suggestions = SuggestCommands(SArray("frobnicate"))
+	if len(suggestions) != 0 {
+		t.Errorf("SuggestCommands(frobnicate) => %s", suggestions)
+	}
+}
+
+func TestMissingParamError(t *testing.T) {
+	InitRoutingTable()
+
+	err := MissingParamError(SArray("droplets", "resize", "123"))
+	if err == nil || !strings.Contains(err.Error(), ":size") {
+		t.Errorf("MissingParamError(droplets resize 123) => %v", err)
+	}
+
+	err = MissingParamError(SArray("droplet", "resize", "123"))
+	if err != nil {
+		t.Errorf("MissingParamError(droplet resize 123) => %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A minimal TOML reader for the config files: key = value pairs and
+// [tables], eg:
+//
+//   ApiKey = "..."
+//
+//   [Profiles.prod]
+//   DefaultRegion = "nyc2"
+//
+// Arrays, inline tables and multi-line strings are not supported.
+
+var tomlBareKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+var tomlIntPattern = regexp.MustCompile(`^[-+]?[0-9]+(_[0-9]+)*$`)
+var tomlFloatPattern = regexp.MustCompile(`^[-+]?[0-9]+(_[0-9]+)*(\.[0-9]+(_[0-9]+)*)?([eE][-+]?[0-9]+)?$`)
+
+func ReadToml(content []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+
+	for ii, rawLine := range strings.Split(string(content), "\n") {
+		lineNo := ii + 1
+		line := strings.TrimSpace(StripComment(rawLine))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[[") {
+			return nil, fmt.Errorf("line %d: arrays of tables are not supported", lineNo)
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: expected '[table]'", lineNo)
+			}
+			path, err := tomlKeyPath(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err)
+			}
+			table, err = tomlTable(root, path)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err)
+			}
+			continue
+		}
+
+		sep := tomlKeyEnd(line)
+		if sep < 0 {
+			return nil, fmt.Errorf("line %d: expected 'key = value'", lineNo)
+		}
+		path, err := tomlKeyPath(line[:sep])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		value, err := tomlValue(strings.TrimSpace(line[sep+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+
+		owner, err := tomlTable(table, path[:len(path)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		key := path[len(path)-1]
+		if _, exists := owner[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key '%s'", lineNo, key)
+		}
+		owner[key] = value
+	}
+
+	return root, nil
+}
+
+// tomlKeyEnd finds the '=' that ends the key, skipping over quoted keys.
+func tomlKeyEnd(line string) int {
+	var quote rune
+	for ii, ch := range line {
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '=':
+			return ii
+		}
+	}
+	return -1
+}
+
+// tomlKeyPath splits a dotted key, eg: Profiles."my prod" => Profiles, my prod
+func tomlKeyPath(text string) ([]string, error) {
+	path := make([]string, 0)
+	for _, part := range splitTomlKey(text) {
+		part = strings.TrimSpace(part)
+		switch {
+		case strings.HasPrefix(part, "\"") || strings.HasPrefix(part, "'"):
+			value, err := tomlValue(part)
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, value.(string))
+		case tomlBareKeyPattern.MatchString(part):
+			path = append(path, part)
+		default:
+			return nil, fmt.Errorf("invalid key '%s'", strings.TrimSpace(text))
+		}
+	}
+	return path, nil
+}
+
+func splitTomlKey(text string) []string {
+	parts := make([]string, 0)
+	var quote rune
+	start := 0
+	for ii, ch := range text {
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '.':
+			parts = append(parts, text[start:ii])
+			start = ii + 1
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// tomlTable finds, or creates, the table at path under root.
+func tomlTable(root map[string]interface{}, path []string) (map[string]interface{}, error) {
+	table := root
+	for _, key := range path {
+		next, exists := table[key]
+		if !exists {
+			child := make(map[string]interface{})
+			table[key] = child
+			table = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'%s' is a value, not a table", key)
+		}
+		table = child
+	}
+	return table, nil
+}
+
+func tomlValue(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "\"\"\"") || strings.HasPrefix(text, "'''"):
+		return nil, fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(text, "\""):
+		str, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", text)
+		}
+		return str, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") || strings.Contains(text[1:len(text)-1], "'") {
+			return nil, fmt.Errorf("invalid string %s", text)
+		}
+		return text[1 : len(text)-1], nil
+	case strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{"):
+		return nil, fmt.Errorf("arrays and inline tables are not supported: %s", text)
+	case text == "true" || text == "false":
+		return text == "true", nil
+	case tomlIntPattern.MatchString(text):
+		return strconv.ParseInt(strings.Replace(text, "_", "", -1), 10, 64)
+	case tomlFloatPattern.MatchString(text):
+		return strconv.ParseFloat(strings.Replace(text, "_", "", -1), 64)
+	}
+	return nil, fmt.Errorf("invalid value '%s', strings must be quoted", text)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A minimal YAML writer, enough to dump the response objects.  Struct fields
+// are written with the same lower cased names used by -o columns and map keys
+// are sorted so the output is stable from run to run.
+
+type yamlEntry struct {
+	Key   string
+	Value reflect.Value
+}
+
+func EmitYaml(v interface{}) error {
+	var buf bytes.Buffer
+	WriteYaml(&buf, reflect.ValueOf(v), 0)
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+func yamlIndirect(val reflect.Value) reflect.Value {
+	for val.IsValid() && (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) {
+		if val.IsNil() {
+			return reflect.Value{}
+		}
+		val = val.Elem()
+	}
+	return val
+}
+
+func yamlEntries(val reflect.Value) []yamlEntry {
+	entries := make([]yamlEntry, 0)
+	switch val.Kind() {
+	case reflect.Struct:
+		for ii := 0; ii < val.NumField(); ii++ {
+			field := val.Type().Field(ii)
+			if field.PkgPath != "" {
+				continue
+			}
+			entries = append(entries, yamlEntry{strings.ToLower(field.Name), val.Field(ii)})
+		}
+	case reflect.Map:
+		for _, key := range val.MapKeys() {
+			entries = append(entries, yamlEntry{fmt.Sprintf("%v", key.Interface()), val.MapIndex(key)})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	}
+	return entries
+}
+
+var yamlPlainScalar = regexp.MustCompile(`^[A-Za-z_/.][A-Za-z0-9_ ./@()-]*$`)
+var yamlReservedScalars = []string{"true", "false", "yes", "no", "on", "off", "null", "y", "n", "~"}
+
+func YamlScalar(val reflect.Value) string {
+	if !val.IsValid() {
+		return "null"
+	}
+
+	switch val.Kind() {
+	case reflect.Bool:
+		return fmt.Sprintf("%t", val.Bool())
+	case reflect.Float32, reflect.Float64:
+		ff := val.Float()
+		if ff == math.Trunc(ff) && math.Abs(ff) < 1e15 {
+			return fmt.Sprintf("%.f", ff)
+		}
+		return fmt.Sprintf("%v", ff)
+	case reflect.String:
+		s := val.String()
+		if yamlPlainScalar.MatchString(s) && !strings.HasSuffix(s, " ") && !StringArrayContains(yamlReservedScalars, strings.ToLower(s)) {
+			return s
+		}
+		quoted, _ := json.Marshal(s)
+		return string(quoted)
+	}
+	return fmt.Sprintf("%v", val.Interface())
+}
+
+func WriteYaml(buf *bytes.Buffer, val reflect.Value, indent int) {
+	val = yamlIndirect(val)
+	pad := strings.Repeat(" ", indent)
+
+	if !val.IsValid() {
+		buf.WriteString(pad + "null\n")
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.Struct, reflect.Map:
+		for _, entry := range yamlEntries(val) {
+			buf.WriteString(pad + entry.Key + ":")
+			writeYamlChild(buf, entry.Value, indent+2)
+		}
+	case reflect.Slice, reflect.Array:
+		for ii := 0; ii < val.Len(); ii++ {
+			buf.WriteString(pad + "-")
+			elt := yamlIndirect(val.Index(ii))
+			if elt.IsValid() && (elt.Kind() == reflect.Struct || elt.Kind() == reflect.Map) && len(yamlEntries(elt)) > 0 {
+				// the first key goes on the same line as the dash
+				var nested bytes.Buffer
+				WriteYaml(&nested, elt, indent+2)
+				buf.WriteString(" ")
+				buf.Write(nested.Bytes()[indent+2:])
+				continue
+			}
+			writeYamlChild(buf, elt, indent+2)
+		}
+	default:
+		buf.WriteString(pad + YamlScalar(val) + "\n")
+	}
+}
+
+func writeYamlChild(buf *bytes.Buffer, val reflect.Value, indent int) {
+	val = yamlIndirect(val)
+	if val.IsValid() {
+		switch val.Kind() {
+		case reflect.Struct, reflect.Map:
+			if len(yamlEntries(val)) == 0 {
+				buf.WriteString(" {}\n")
+				return
+			}
+			buf.WriteString("\n")
+			WriteYaml(buf, val, indent)
+			return
+		case reflect.Slice, reflect.Array:
+			if val.Len() == 0 {
+				buf.WriteString(" []\n")
+				return
+			}
+			buf.WriteString("\n")
+			WriteYaml(buf, val, indent)
+			return
+		}
+	}
+	buf.WriteString(" " + YamlScalar(val) + "\n")
+}
+
+// A minimal YAML reader for the config files: nested maps of scalars, eg:
+//
+//   ApiKey: "..."
+//   Profiles:
+//     prod:
+//       DefaultRegion: nyc2
+//
+// Lists and flow style ({..}, [..]) are not supported.
+
+type yamlLevel struct {
+	Indent int
+	Parent int
+	Key    string
+	Map    map[string]interface{}
+	Owner  map[string]interface{}
+}
+
+func ReadYaml(content []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	stack := []*yamlLevel{{Indent: -1, Parent: -1, Map: root}}
+
+	// a key with nothing nested under it is null
+	pop := func() {
+		top := stack[len(stack)-1]
+		if top.Indent == -1 && top.Owner != nil {
+			top.Owner[top.Key] = nil
+		}
+		stack = stack[:len(stack)-1]
+	}
+
+	for ii, rawLine := range strings.Split(string(content), "\n") {
+		lineNo := ii + 1
+		line := strings.TrimRight(StripComment(rawLine), " \t\r")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", lineNo)
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			return nil, fmt.Errorf("line %d: lists are not supported", lineNo)
+		}
+
+		for len(stack) > 1 && indent <= stack[len(stack)-1].Parent {
+			pop()
+		}
+		top := stack[len(stack)-1]
+		if top.Indent == -1 {
+			top.Indent = indent
+		}
+		if indent != top.Indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+		}
+
+		sep := strings.Index(trimmed, ": ")
+		if sep < 0 && strings.HasSuffix(trimmed, ":") {
+			sep = len(trimmed) - 1
+		}
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", lineNo)
+		}
+
+		key, err := yamlKey(trimmed[:sep])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		if _, exists := top.Map[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key '%s'", lineNo, key)
+		}
+
+		text := strings.TrimSpace(trimmed[sep+1:])
+		if text == "" {
+			child := make(map[string]interface{})
+			top.Map[key] = child
+			stack = append(stack, &yamlLevel{Indent: -1, Parent: indent, Key: key, Map: child, Owner: top.Map})
+			continue
+		}
+
+		value, err := yamlScalar(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		top.Map[key] = value
+	}
+
+	for len(stack) > 1 {
+		pop()
+	}
+	return root, nil
+}
+
+func yamlKey(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		value, err := yamlScalar(text)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v", value), nil
+	}
+	return text, nil
+}
+
+var yamlIntPattern = regexp.MustCompile(`^[-+]?[0-9]+$`)
+var yamlFloatPattern = regexp.MustCompile(`^[-+]?([0-9]+\.[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+
+func yamlScalar(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "\""):
+		var str string
+		if err := json.Unmarshal([]byte(text), &str); err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", text)
+		}
+		return str, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", text)
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	case strings.HasPrefix(text, "{") || strings.HasPrefix(text, "["):
+		return nil, fmt.Errorf("flow style values are not supported: %s", text)
+	case text == "true" || text == "false":
+		return text == "true", nil
+	case text == "null" || text == "~":
+		return nil, nil
+	case yamlIntPattern.MatchString(text):
+		var ii int64
+		if _, err := fmt.Sscan(text, &ii); err == nil {
+			return ii, nil
+		}
+	case yamlFloatPattern.MatchString(text):
+		var ff float64
+		if _, err := fmt.Sscan(text, &ff); err == nil && !math.IsInf(ff, 0) {
+			return ff, nil
+		}
+	}
+	return text, nil
+}
+
+// StripComment removes a # comment from a line of YAML or TOML, leaving #s
+// inside quoted strings alone.
+func StripComment(line string) string {
+	var quote rune
+	escaped := false
+	for ii, ch := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && ch == '\\':
+			escaped = true
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#' && (ii == 0 || line[ii-1] == ' ' || line[ii-1] == '\t'):
+			return line[:ii]
+		}
+	}
+	return line
+}